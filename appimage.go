@@ -48,6 +48,8 @@ func installAppImageOptionsFromCLIContext(context *cli.Context) (types.InstallOp
 		DoNotFilter:            context.Bool("no-filter"),
 		Silent:                 context.Bool("silent"),
 		SelectFirst:            context.Bool("select-first"),
+		Extract:                context.Bool("extract"),
+		ExecutableConflict:     context.String("executable-conflict"),
 	}
 	logger.Debug(app)
 	return app, nil
@@ -0,0 +1,261 @@
+package appimage
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/srevinsaju/zap/config"
+	"github.com/srevinsaju/zap/exceptions"
+	"github.com/srevinsaju/zap/internal/helpers"
+	"github.com/srevinsaju/zap/tui"
+	"github.com/srevinsaju/zap/types"
+	"gopkg.in/ini.v1"
+)
+
+var (
+	// versionSuffixPattern matches the version and architecture, which
+	// file names of appimages usually end with, like -1.2.3-x86_64
+	versionSuffixPattern = regexp.MustCompile(`[-_ .]v?[0-9].*$|[-_ .](x86_64|amd64|aarch64|arm64|armhf|i386|i686)$`)
+
+	invalidExecutablePattern = regexp.MustCompile(`[^a-z0-9._+-]+`)
+)
+
+// isAppImageCandidate returns true if the file at p looks like an appimage
+func isAppImageCandidate(p string) bool {
+	info, err := os.Stat(p)
+	if err != nil || !info.Mode().IsRegular() {
+		return false
+	}
+	return strings.HasSuffix(strings.ToLower(p), ".appimage") || isAppImageFile(p)
+}
+
+// adoptedExecutableName derives the name of the executable of an appimage
+// from the Exec of its desktop file, or otherwise from its file name
+func adoptedExecutableName(desktopFile *ini.File, file string) string {
+	name := ""
+	if desktopFile != nil {
+		exec := strings.Fields(desktopFile.Section("Desktop Entry").Key("Exec").String())
+		if len(exec) > 0 && !strings.EqualFold(path.Base(exec[0]), "AppRun") {
+			name = path.Base(exec[0])
+		}
+	}
+	if name == "" {
+		name = path.Base(file)
+		if strings.HasSuffix(strings.ToLower(name), ".appimage") {
+			name = name[:len(name)-len(".appimage")]
+		}
+		name = versionSuffixPattern.ReplaceAllString(name, "")
+	}
+	name = invalidExecutablePattern.ReplaceAllString(strings.ToLower(name), "-")
+	return strings.Trim(name, "-.")
+}
+
+// sourceFromUpdateInformation returns the source an appimage is updated
+// from, according to the update information embedded in it
+func sourceFromUpdateInformation(file string) Source {
+	source := Source{
+		Identifier: SourceDirectURL,
+		Meta: SourceMetadata{
+			Slug:      fmt.Sprintf("file://%s", file),
+			CrawledOn: time.Now().String(),
+		},
+	}
+
+	updInfo := updateInformation(file)
+	if updInfo == "" {
+		return source
+	}
+	// the update information is kept, the GitHub slug does not
+	// tell which of the assets of a release is the appimage
+	source.Meta.URL = updInfo
+
+	// gh-releases-zsync|owner|repo|tag|filename
+	parts := strings.Split(updInfo, "|")
+	if len(parts) >= 3 && parts[0] == "gh-releases-zsync" {
+		source.Identifier = SourceGitHub
+		source.Meta.Slug = fmt.Sprintf("%s/%s", parts[1], parts[2])
+		return source
+	}
+	source.Identifier = SourceUpdateInformation
+	return source
+}
+
+// adoptedExecutable returns the executable an appimage at file is
+// installed as, if it has already been adopted
+func adoptedExecutable(file string, config config.Store) string {
+	apps, err := List(config, false)
+	if err != nil {
+		return ""
+	}
+	for _, executable := range apps {
+		app, err := loadIndex(executable, config)
+		if err == nil && app.Filepath == file {
+			return executable
+		}
+	}
+	return ""
+}
+
+// adoptedInPlace returns true if the appimage was adopted where it is,
+// outside LocalStore, so it belongs to the user
+func (appimage AppImage) adoptedInPlace(cfg config.Store) bool {
+	return !strings.HasPrefix(appimage.Filepath, path.Clean(cfg.LocalStore)+"/")
+}
+
+// moveFile moves the file at src to dst, even if they are
+// on different file systems
+func moveFile(src string, dst string) error {
+	err := os.Rename(src, dst)
+	if err == nil {
+		return nil
+	}
+	logger.Debugf("Failed to rename %s to %s, copying it instead, %s", src, dst, err)
+	_, err = helpers.CopyFile(src, dst)
+	if err != nil {
+		_ = os.Remove(dst)
+		return err
+	}
+	err = os.Chmod(dst, 0755)
+	if err != nil {
+		return err
+	}
+	return os.Remove(src)
+}
+
+// Adopt installs an appimage which is already on disk, without downloading
+// it again. It is installed where it is, or moved into LocalStore
+func Adopt(file string, options types.AdoptOptions, config config.Store) error {
+	file, err := filepath.Abs(file)
+	if err != nil {
+		return err
+	}
+	if !isAppImageCandidate(file) {
+		return fmt.Errorf("%s is not an appimage", file)
+	}
+	if executable := adoptedExecutable(file, config); executable != "" {
+		fmt.Printf("%s is already installed as %s\n", file, tui.Yellow(executable))
+		return nil
+	}
+
+	err = os.Chmod(file, 0755)
+	if err != nil {
+		return err
+	}
+	app := &AppImage{Filepath: file}
+
+	desktopFile, err := app.loadDesktopFile()
+	if err != nil {
+		logger.Debugf("Failed to read the desktop file of %s, %s", file, err)
+	}
+	app.Executable = options.Executable
+	if app.Executable == "" {
+		app.Executable = adoptedExecutableName(desktopFile, file)
+	}
+	if app.Executable == "" {
+		return fmt.Errorf("could not find a name for %s, use --executable", file)
+	}
+	if _, err := loadIndex(app.Executable, config); err != exceptions.NotInstalledError {
+		return fmt.Errorf("%s is already installed, use --executable to install %s with another name", app.Executable, file)
+	}
+	executable, replaceLauncher, err := app.resolveExecutableConflict(app.Executable, options.ExecutableConflict, !options.Silent, config)
+	if err != nil || executable == "" {
+		return err
+	}
+	app.Executable = executable
+
+	app.Source = sourceFromUpdateInformation(file)
+
+	if options.Move {
+		target := path.Join(config.LocalStore, path.Base(file))
+		if helpers.CheckIfFileExists(target) {
+			return fmt.Errorf("%s already exists", target)
+		}
+		logger.Debugf("Moving %s to %s", file, target)
+		err = moveFile(file, target)
+		if err != nil {
+			return err
+		}
+		app.Filepath = target
+		app.migratePortableDirs(file)
+	}
+
+	app.Sha256, err = helpers.Sha256File(app.Filepath)
+	if err != nil {
+		return err
+	}
+
+	if config.ExtractAppImages {
+		app.Extracted, err = app.extractTree(config)
+		if err != nil {
+			return err
+		}
+	} else if !fuseAvailable() {
+		suggestExtractMode(app.Executable)
+	}
+
+	app.ExtractThumbnail(config.IconStore)
+	app.installShellFiles(config)
+	if options.Integrate {
+		desktopFile, err := app.loadDesktopFile()
+		if err == nil {
+			err = app.integrate(config, desktopFile)
+		}
+		if err != nil {
+			logger.Warnf("Not integrating %s with the desktop, %s", app.Executable, err)
+		}
+	} else {
+		app.ProcessDesktopFile(config)
+	}
+
+	err = saveIndex(app, config)
+	if err != nil {
+		return err
+	}
+
+	err = os.MkdirAll(path.Dir(binFilePath(app.Executable)), 0755)
+	if err != nil {
+		return err
+	}
+	if replaceLauncher {
+		logger.Debugf("Replacing %s, on user request", binFilePath(app.Executable))
+		err = os.Remove(binFilePath(app.Executable))
+		if err != nil {
+			return err
+		}
+	}
+	err = app.refreshLauncher(config)
+	if err != nil {
+		logger.Warnf("Failed to create the launcher of %s, %s", app.Executable, err)
+	}
+
+	fmt.Printf("✨ %s installed as %s\n", app.Filepath, tui.Green(app.Executable))
+	return nil
+}
+
+// AdoptDir adopts every appimage in dir. The appimages which cannot be
+// adopted are skipped
+func AdoptDir(dir string, options types.AdoptOptions, config config.Store) error {
+	if options.Executable != "" {
+		return fmt.Errorf("--executable cannot be used with a directory")
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		file := path.Join(dir, entry.Name())
+		if !isAppImageCandidate(file) {
+			continue
+		}
+		err = Adopt(file, options, config)
+		if err != nil {
+			fmt.Printf("%s%s %s\n", tui.Blue("[adopt]"), tui.Red(fmt.Sprintf("[%s]", entry.Name())), tui.Yellow(err))
+		}
+	}
+	return nil
+}
@@ -0,0 +1,120 @@
+package appimage
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path"
+
+	"github.com/adrg/xdg"
+	"github.com/srevinsaju/zap/config"
+	"github.com/srevinsaju/zap/tui"
+	"gopkg.in/ini.v1"
+)
+
+// autostartDir returns the directory of the XDG autostart entries of the user
+func autostartDir() string {
+	return path.Join(xdg.ConfigHome, "autostart")
+}
+
+// autostartFilePath returns the autostart entry of executable
+func autostartFilePath(executable string) string {
+	return path.Join(autostartDir(), fmt.Sprintf("zap-%s.desktop", executable))
+}
+
+// installAutostart writes an XDG autostart entry for the appimage. The entry
+// launches the appimage through ~/.local/bin, which does not change when
+// the appimage is updated
+func (appimage AppImage) installAutostart() error {
+	ini.PrettyFormat = false
+
+	name := appimage.Executable
+	if desktopFile, err := appimage.loadDesktopFile(); err == nil {
+		desktopEntry := desktopFile.Section("Desktop Entry")
+		if desktopEntry.HasKey("Name") {
+			name = desktopEntry.Key("Name").String()
+		}
+	}
+
+	icon := appimage.IconPath
+	if len(appimage.Icons) > 0 {
+		icon = appimage.appIconName()
+	}
+
+	binFile := path.Join(xdg.Home, ".local", "bin", appimage.Executable)
+
+	autostartFile := ini.Empty(ini.LoadOptions{IgnoreInlineComment: true})
+	desktopEntry := autostartFile.Section("Desktop Entry")
+	desktopEntry.Key("Type").SetValue("Application")
+	desktopEntry.Key("Name").SetValue(name)
+	desktopEntry.Key("Exec").SetValue(quoteExecArg(binFile))
+	desktopEntry.Key("TryExec").SetValue(binFile)
+	if icon != "" {
+		desktopEntry.Key("Icon").SetValue(icon)
+	}
+	desktopEntry.Key("X-Zap-Id").SetValue(appimage.Executable)
+	desktopEntry.Key("X-GNOME-Autostart-enabled").SetValue("true")
+
+	var b bytes.Buffer
+	_, err := autostartFile.WriteTo(&b)
+	if err != nil {
+		return err
+	}
+
+	err = os.MkdirAll(autostartDir(), 0755)
+	if err != nil {
+		return err
+	}
+	target := autostartFilePath(appimage.Executable)
+	logger.Debugf("Writing autostart entry to %s", target)
+	return writeFileAtomic(target, b.Bytes(), 0644)
+}
+
+// uninstallAutostart removes the autostart entry of executable
+func uninstallAutostart(executable string) {
+	target := autostartFilePath(executable)
+	logger.Debugf("Removing autostart entry, %s", target)
+	err := os.Remove(target)
+	if err != nil && !os.IsNotExist(err) {
+		logger.Warnf("Failed to remove autostart entry, %s", err)
+	}
+}
+
+// EnableAutostart starts an installed app when the user logs in
+func EnableAutostart(executable string, config config.Store) error {
+	app, err := loadIndex(executable, config)
+	if err != nil {
+		return err
+	}
+
+	err = app.installAutostart()
+	if err != nil {
+		return err
+	}
+	app.Autostart = true
+
+	err = saveIndex(app, config)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("✨ %s will be started when you log in\n", tui.Green(executable))
+	return nil
+}
+
+// DisableAutostart stops starting an installed app when the user logs in
+func DisableAutostart(executable string, config config.Store) error {
+	app, err := loadIndex(executable, config)
+	if err != nil {
+		return err
+	}
+
+	uninstallAutostart(executable)
+	app.Autostart = false
+
+	err = saveIndex(app, config)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("✨ %s will no longer be started when you log in\n", tui.Green(executable))
+	return nil
+}
@@ -0,0 +1,186 @@
+package appimage
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+
+	"github.com/AlecAivazis/survey/v2"
+	"github.com/AlecAivazis/survey/v2/terminal"
+	"github.com/srevinsaju/zap/config"
+	"github.com/srevinsaju/zap/exceptions"
+	"github.com/srevinsaju/zap/tui"
+)
+
+// what to do, if the launcher of an appimage conflicts with a file in
+// ~/.local/bin, or with a command elsewhere on PATH
+const (
+	// ConflictRename installs the appimage with another name
+	ConflictRename = "rename"
+
+	// ConflictSkip does not install the appimage
+	ConflictSkip = "skip"
+
+	// ConflictOverwrite replaces the file in ~/.local/bin,
+	// or shadows the command elsewhere on PATH
+	ConflictOverwrite = "overwrite"
+
+	// ConflictFail aborts the installation
+	ConflictFail = "fail"
+)
+
+// shadowedCommand returns the command named executable elsewhere on PATH,
+// which the launcher in ~/.local/bin would shadow, or be shadowed by
+func shadowedCommand(executable string) string {
+	binDir := path.Dir(binFilePath(executable))
+	realBinDir, err := filepath.EvalSymlinks(binDir)
+	if err != nil {
+		realBinDir = binDir
+	}
+	for _, dir := range filepath.SplitList(os.Getenv("PATH")) {
+		if dir == "" {
+			continue
+		}
+		realDir, err := filepath.EvalSymlinks(dir)
+		if err != nil {
+			continue
+		}
+		if path.Clean(dir) == binDir || realDir == realBinDir {
+			continue
+		}
+		command := path.Join(dir, executable)
+		info, err := os.Stat(command)
+		if err == nil && !info.IsDir() && info.Mode()&0111 != 0 {
+			return command
+		}
+	}
+	return ""
+}
+
+// foreignLauncher returns true if ~/.local/bin/<executable> exists, and
+// cannot be replaced by the launcher of the appimage. Symlinks which do
+// not resolve can be replaced
+func (appimage AppImage) foreignLauncher(executable string, cfg config.Store) bool {
+	binFile := binFilePath(executable)
+	if _, err := os.Lstat(binFile); err != nil {
+		return false
+	}
+	if _, err := filepath.EvalSymlinks(binFile); err != nil {
+		return false
+	}
+	return !appimage.ownsLauncher(binFile, cfg)
+}
+
+// executableConflict describes the conflict installing the appimage as
+// executable would cause, and returns true if it would replace a file
+// which was not created by zap
+func (appimage AppImage) executableConflict(executable string, cfg config.Store) (string, bool) {
+	if appimage.foreignLauncher(executable, cfg) {
+		return fmt.Sprintf("%s already exists, and was not created by zap", binFilePath(executable)), true
+	}
+	if command := shadowedCommand(executable); command != "" {
+		return fmt.Sprintf("%s is also %s", executable, command), false
+	}
+	return "", false
+}
+
+// alternativeExecutable returns a name for the appimage, derived from
+// executable, which does not conflict with anything
+func (appimage AppImage) alternativeExecutable(executable string, cfg config.Store) string {
+	for i := 1; ; i++ {
+		candidate := fmt.Sprintf("%s-appimage", executable)
+		if i > 1 {
+			candidate = fmt.Sprintf("%s-appimage-%d", executable, i)
+		}
+		if _, err := loadIndex(candidate, cfg); err != exceptions.NotInstalledError {
+			continue
+		}
+		if conflict, _ := appimage.executableConflict(candidate, cfg); conflict == "" {
+			return candidate
+		}
+	}
+}
+
+// resolveExecutableConflict checks that the launcher of the appimage can be
+// installed as executable, and resolves the conflict according to policy.
+// Without a policy, the user is asked, unless interactive is false, then
+// files which were not created by zap are not replaced, and commands on
+// PATH are shadowed. It returns the name to install the appimage as, or
+// "" to skip it, and true if the file in ~/.local/bin has to be replaced
+func (appimage AppImage) resolveExecutableConflict(executable string, policy string, interactive bool, cfg config.Store) (string, bool, error) {
+	switch policy {
+	case "", ConflictRename, ConflictSkip, ConflictOverwrite, ConflictFail:
+	default:
+		return "", false, fmt.Errorf("invalid --executable-conflict %s, expected %s, %s, %s or %s",
+			policy, ConflictRename, ConflictSkip, ConflictOverwrite, ConflictFail)
+	}
+
+	conflict, foreign := appimage.executableConflict(executable, cfg)
+	if conflict == "" {
+		return executable, false, nil
+	}
+
+	interactive = interactive && policy == ""
+	if interactive {
+		err := survey.AskOne(&survey.Select{
+			Message: fmt.Sprintf("%s. What do you want to do?", conflict),
+			Options: []string{ConflictRename, ConflictOverwrite, ConflictSkip, ConflictFail},
+			Default: ConflictRename,
+			Help: "rename installs the AppImage with another name, overwrite replaces the file " +
+				"in ~/.local/bin, or shadows the command, skip does not install the AppImage",
+		}, &policy)
+		if err == terminal.InterruptErr {
+			return "", false, err
+		} else if err != nil {
+			logger.Debugf("Failed to ask how to resolve the conflict, %s", err)
+			interactive = false
+			policy = ""
+		}
+	}
+	if policy == "" {
+		if foreign {
+			policy = ConflictFail
+		} else {
+			logger.Warnf("%s, one of them shadows the other, depending on the order of PATH", conflict)
+			return executable, false, nil
+		}
+	}
+
+	switch policy {
+	case ConflictRename:
+		alternative := appimage.alternativeExecutable(executable, cfg)
+		if interactive {
+			err := survey.AskOne(&survey.Input{
+				Message: "Install it as",
+				Default: alternative,
+			}, &alternative, survey.WithValidator(func(ans interface{}) error {
+				name := ans.(string)
+				if name == "" || name != path.Base(name) {
+					return errors.New("invalid name")
+				}
+				if _, err := loadIndex(name, cfg); err != exceptions.NotInstalledError {
+					return fmt.Errorf("%s is already installed", name)
+				}
+				if conflict, _ := appimage.executableConflict(name, cfg); conflict != "" {
+					return errors.New(conflict)
+				}
+				return nil
+			}))
+			if err == terminal.InterruptErr {
+				return "", false, err
+			} else if err != nil {
+				logger.Debugf("Failed to ask for another name, %s", err)
+			}
+		}
+		fmt.Printf("%s, installing it as %s\n", conflict, tui.Green(alternative))
+		return alternative, false, nil
+	case ConflictSkip:
+		fmt.Printf("%s, skipping it\n", conflict)
+		return "", false, nil
+	case ConflictOverwrite:
+		return executable, foreign, nil
+	}
+	return "", false, fmt.Errorf("%s, use --executable, or --executable-conflict to resolve the conflict", conflict)
+}
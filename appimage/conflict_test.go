@@ -0,0 +1,88 @@
+package appimage
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/adrg/xdg"
+	"github.com/srevinsaju/zap/config"
+)
+
+func TestResolveExecutableConflict(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	xdg.Reload()
+	t.Cleanup(xdg.Reload)
+
+	binDir := filepath.Join(home, ".local", "bin")
+	otherBinDir := filepath.Join(home, "usr", "bin")
+	cfg := config.Store{
+		LocalStore: filepath.Join(home, "zap"),
+		IndexStore: filepath.Join(home, "zap", "index"),
+	}
+	for _, d := range []string{binDir, otherBinDir, cfg.IndexStore} {
+		if err := os.MkdirAll(d, 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	t.Setenv("PATH", otherBinDir+string(filepath.ListSeparator)+binDir)
+
+	files := map[string]string{
+		// not created by zap
+		filepath.Join(binDir, "foo"): "#!/bin/sh\n",
+		// the launcher of an installed appimage
+		filepath.Join(binDir, "own"): "#!/bin/sh\n" + launcherMarker + "\n",
+		// on PATH, outside of ~/.local/bin
+		filepath.Join(otherBinDir, "bar"): "#!/bin/sh\n",
+		// foo-appimage is installed already
+		filepath.Join(cfg.IndexStore, "foo-appimage.json"): `{"executable": "foo-appimage"}`,
+	}
+	for file, content := range files {
+		if err := os.WriteFile(file, []byte(content), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.Symlink(filepath.Join(home, "missing.AppImage"), filepath.Join(binDir, "dangling")); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		executable  string
+		policy      string
+		want        string
+		wantReplace bool
+		wantErr     bool
+	}{
+		{executable: "baz", policy: ConflictFail, want: "baz"},
+		{executable: "own", want: "own"},
+		{executable: "dangling", policy: ConflictFail, want: "dangling"},
+		{executable: "baz", policy: "ignore", wantErr: true},
+
+		// without a policy, files not created by zap are not replaced
+		{executable: "foo", wantErr: true},
+		{executable: "foo", policy: ConflictRename, want: "foo-appimage-2"},
+		{executable: "foo", policy: ConflictSkip, want: ""},
+		{executable: "foo", policy: ConflictOverwrite, want: "foo", wantReplace: true},
+		{executable: "foo", policy: ConflictFail, wantErr: true},
+
+		// without a policy, commands on PATH are shadowed
+		{executable: "bar", want: "bar"},
+		{executable: "bar", policy: ConflictRename, want: "bar-appimage"},
+		{executable: "bar", policy: ConflictSkip, want: ""},
+		{executable: "bar", policy: ConflictOverwrite, want: "bar"},
+		{executable: "bar", policy: ConflictFail, wantErr: true},
+	}
+	for _, tt := range tests {
+		// a policy is never asked for
+		got, replace, err := AppImage{}.resolveExecutableConflict(tt.executable, tt.policy, tt.policy != "", cfg)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("resolveExecutableConflict(%s, %q) error = %v, want error %v", tt.executable, tt.policy, err, tt.wantErr)
+			continue
+		}
+		if got != tt.want || replace != tt.wantReplace {
+			t.Errorf("resolveExecutableConflict(%s, %q) = %q, %v, want %q, %v",
+				tt.executable, tt.policy, got, replace, tt.want, tt.wantReplace)
+		}
+	}
+}
@@ -0,0 +1,186 @@
+package appimage
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/srevinsaju/zap/config"
+	"gopkg.in/ini.v1"
+)
+
+// installDesktopFile writes the desktop entry of executable into
+// config.ApplicationStore, and updates the caches which desktop
+// environments read, the way xdg-desktop-menu would. xdg-desktop-menu
+// is only used if it was explicitly configured with UseXdgDesktopMenu.
+// It returns the path of the installed desktop file
+func installDesktopFile(cfg config.Store, desktopFile *ini.File, executable string) (string, error) {
+	desktopFileName := fmt.Sprintf("%s.desktop", executable)
+	targetDesktopFile := path.Join(cfg.ApplicationStore, desktopFileName)
+
+	if cfg.UseXdgDesktopMenu && commandExists("xdg-desktop-menu") {
+		// xdg-desktop-menu installs a copy of the desktop file, so we
+		// stage it in the local store first
+		tempDesktopDir := path.Join(cfg.LocalStore, "desktop")
+		err := os.MkdirAll(tempDesktopDir, 0755)
+		if err != nil {
+			return "", err
+		}
+		stagedDesktopFile := path.Join(tempDesktopDir, desktopFileName)
+		logger.Debugf("Preparing %s for xdg-desktop-menu", stagedDesktopFile)
+		err = desktopFile.SaveTo(stagedDesktopFile)
+		if err != nil {
+			return "", err
+		}
+		xdgDesktopMenuInstall(stagedDesktopFile)
+		return targetDesktopFile, nil
+	} else if cfg.UseXdgDesktopMenu {
+		logger.Warn("UseXdgDesktopMenu is configured, but 'xdg-desktop-menu' could not be found. " +
+			"Falling back to zap's desktop integration")
+	}
+
+	err := os.MkdirAll(cfg.ApplicationStore, 0755)
+	if err != nil {
+		return "", err
+	}
+
+	// write into a temporary file first, so that desktop environments
+	// watching the directory never see a partially written desktop file
+	tmpDesktopFile := fmt.Sprintf("%s.tmp", targetDesktopFile)
+	logger.Debugf("Preparing %s for writing new desktop file", tmpDesktopFile)
+	err = desktopFile.SaveTo(tmpDesktopFile)
+	if err != nil {
+		return "", err
+	}
+	err = os.Chmod(tmpDesktopFile, 0755)
+	if err != nil {
+		return "", err
+	}
+	err = os.Rename(tmpDesktopFile, targetDesktopFile)
+	if err != nil {
+		_ = os.Remove(tmpDesktopFile)
+		return "", err
+	}
+
+	refreshDesktopDatabase(cfg)
+	return targetDesktopFile, nil
+}
+
+// uninstallDesktopFile removes a desktop file installed by
+// installDesktopFile, and updates the caches
+func uninstallDesktopFile(cfg config.Store, desktopFile string) {
+	desktopFileName := filepath.Base(desktopFile)
+
+	if cfg.UseXdgDesktopMenu && commandExists("xdg-desktop-menu") {
+		xdgDesktopMenuUninstall(desktopFile)
+	}
+
+	// indexes written by older versions of zap record the copy staged
+	// for xdg-desktop-menu in the local store, so remove both of them
+	for _, f := range []string{
+		desktopFile,
+		path.Join(cfg.LocalStore, "desktop", desktopFileName),
+		path.Join(cfg.ApplicationStore, desktopFileName),
+	} {
+		err := os.Remove(f)
+		if err == nil {
+			logger.Debugf("Removed desktop file, %s", f)
+		} else if !os.IsNotExist(err) {
+			logger.Debugf("Failed to remove %s, %s", f, err)
+		}
+	}
+
+	refreshDesktopDatabase(cfg)
+}
+
+// refreshDesktopDatabase updates mimeinfo.cache in the application store,
+// and lets the desktop environment know that the icon theme changed
+func refreshDesktopDatabase(cfg config.Store) {
+	err := updateDesktopDatabase(cfg.ApplicationStore)
+	if err != nil {
+		logger.Warnf("Failed to update %s, %s", path.Join(cfg.ApplicationStore, "mimeinfo.cache"), err)
+	}
+	refreshIconTheme()
+}
+
+// updateDesktopDatabase regenerates mimeinfo.cache in dir, which maps
+// every MIME type to the desktop files which can open it, like
+// update-desktop-database does
+func updateDesktopDatabase(dir string) error {
+	mimeCache := map[string][]string{}
+
+	err := filepath.Walk(dir, func(file string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() || !strings.HasSuffix(file, ".desktop") {
+			return nil
+		}
+
+		// desktop files in subdirectories have the subdirectory as
+		// their prefix, kde4/konsole.desktop is kde4-konsole.desktop
+		rel, err := filepath.Rel(dir, file)
+		if err != nil {
+			return err
+		}
+		desktopFileId := strings.ReplaceAll(rel, string(os.PathSeparator), "-")
+
+		desktopFile, err := ini.LoadSources(ini.LoadOptions{IgnoreInlineComment: true}, file)
+		if err != nil {
+			logger.Debugf("Skipping %s, %s", file, err)
+			return nil
+		}
+		desktopEntry := desktopFile.Section("Desktop Entry")
+		if desktopEntry.Key("Hidden").MustBool(false) {
+			return nil
+		}
+
+		for _, mimeType := range strings.Split(desktopEntry.Key("MimeType").String(), ";") {
+			mimeType = strings.TrimSpace(mimeType)
+			if mimeType == "" {
+				continue
+			}
+			mimeCache[mimeType] = append(mimeCache[mimeType], desktopFileId)
+		}
+		return nil
+	})
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	mimeTypes := make([]string, 0, len(mimeCache))
+	for mimeType := range mimeCache {
+		mimeTypes = append(mimeTypes, mimeType)
+	}
+	sort.Strings(mimeTypes)
+
+	var b strings.Builder
+	b.WriteString("[MIME Cache]\n")
+	for _, mimeType := range mimeTypes {
+		desktopFileIds := mimeCache[mimeType]
+		sort.Strings(desktopFileIds)
+		b.WriteString(fmt.Sprintf("%s=%s;\n", mimeType, strings.Join(desktopFileIds, ";")))
+	}
+
+	return writeFileAtomic(path.Join(dir, "mimeinfo.cache"), []byte(b.String()), 0644)
+}
+
+// writeFileAtomic writes data into a temporary file next to target, and
+// renames it to target
+func writeFileAtomic(target string, data []byte, perm os.FileMode) error {
+	tmp := fmt.Sprintf("%s.tmp", target)
+	err := os.WriteFile(tmp, data, perm)
+	if err != nil {
+		return err
+	}
+	err = os.Rename(tmp, target)
+	if err != nil {
+		_ = os.Remove(tmp)
+	}
+	return err
+}
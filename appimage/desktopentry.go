@@ -0,0 +1,322 @@
+package appimage
+
+import (
+	"errors"
+	"fmt"
+	"path"
+	"regexp"
+	"strings"
+
+	"gopkg.in/ini.v1"
+)
+
+// execArg is an argument of the Exec key of a desktop entry, with its
+// position in the raw value
+type execArg struct {
+	value  string
+	quoted bool
+	start  int
+	end    int
+}
+
+// splitExec splits the Exec key of a desktop entry into its arguments,
+// following the quoting rules of the desktop entry specification
+func splitExec(exec string) ([]execArg, error) {
+	var args []execArg
+	var current *execArg
+	var b strings.Builder
+
+	inQuotes := false
+	for i := 0; i < len(exec); i++ {
+		c := exec[i]
+		if !inQuotes && (c == ' ' || c == '\t') {
+			if current != nil {
+				current.value = b.String()
+				current.end = i
+				args = append(args, *current)
+				current = nil
+				b.Reset()
+			}
+			continue
+		}
+		if current == nil {
+			current = &execArg{start: i}
+		}
+		switch {
+		case c == '"':
+			inQuotes = !inQuotes
+			current.quoted = true
+		case c == '\\' && inQuotes && i+1 < len(exec) && strings.IndexByte("\"`$\\", exec[i+1]) != -1:
+			i++
+			b.WriteByte(exec[i])
+		default:
+			b.WriteByte(c)
+		}
+	}
+	if inQuotes {
+		return nil, errors.New("unterminated quote")
+	}
+	if current != nil {
+		current.value = b.String()
+		current.end = len(exec)
+		args = append(args, *current)
+	}
+	return args, nil
+}
+
+// quoteExecArg quotes arg for the Exec key, if it needs to be quoted
+func quoteExecArg(arg string) string {
+	if !strings.ContainsAny(arg, " \t\n\"'\\><~|&;$*?#()`") {
+		return arg
+	}
+	r := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "`", "\\`", `$`, `\$`)
+	return fmt.Sprintf(`"%s"`, r.Replace(arg))
+}
+
+// envProgram returns the index of the program env(1) runs, after its
+// options and environment variables, in args, which start with env
+func envProgram(args []execArg) int {
+	i := 1
+	for i < len(args) {
+		value := args[i].value
+		switch {
+		case value == "-u" || value == "-C" || value == "--unset" || value == "--chdir":
+			// options followed by their value
+			i += 2
+		case strings.HasPrefix(value, "-") || strings.Contains(value, "="):
+			i++
+		default:
+			return i
+		}
+	}
+	return len(args)
+}
+
+// rewriteExec replaces the program of the Exec key with program, and
+// keeps the arguments and field codes of the original Exec key as they
+// are. Environment variables set with env(1) are kept too
+func rewriteExec(exec string, program string) (string, error) {
+	args, err := splitExec(exec)
+	if err != nil {
+		return "", err
+	}
+	if len(args) == 0 {
+		return quoteExecArg(program), nil
+	}
+
+	i := 0
+	if path.Base(args[0].value) == "env" {
+		i = envProgram(args)
+		if i == len(args) {
+			return "", errors.New("no program after env")
+		}
+	}
+	return exec[:args[i].start] + quoteExecArg(program) + exec[args[i].end:], nil
+}
+
+var (
+	desktopEntryKeyPattern = regexp.MustCompile(`^[A-Za-z0-9-]+(\[[A-Za-z0-9_@.-]+])?$`)
+	fieldCodePattern       = regexp.MustCompile(`%.`)
+)
+
+// validateExec checks the field codes of the Exec key
+func validateExec(exec string) error {
+	args, err := splitExec(exec)
+	if err != nil {
+		return err
+	}
+	if len(args) == 0 {
+		return errors.New("empty Exec")
+	}
+
+	fileCodes := 0
+	for _, arg := range args {
+		for _, code := range fieldCodePattern.FindAllString(arg.value, -1) {
+			if code == "%%" {
+				continue
+			}
+			if arg.quoted {
+				return fmt.Errorf("field code %s must not be quoted", code)
+			}
+			switch code {
+			case "%f", "%u":
+				fileCodes++
+			case "%F", "%U":
+				fileCodes++
+				if arg.value != code {
+					return fmt.Errorf("field code %s must be an argument on its own", code)
+				}
+			case "%i", "%c", "%k", "%d", "%D", "%n", "%N", "%v", "%m":
+			default:
+				return fmt.Errorf("unknown field code %s", code)
+			}
+		}
+	}
+	if fileCodes > 1 {
+		return errors.New("only one of %f, %F, %u and %U may be used")
+	}
+	return nil
+}
+
+// validateDesktopFile checks the parts of the desktop entry specification
+// which desktop environments rely on to show an entry, and returns the
+// problems found. Warnings are problems which desktop environments
+// tolerate, so the entry is still shown
+func validateDesktopFile(desktopFile *ini.File) (problems []error, warnings []error) {
+	desktopEntry, err := desktopFile.GetSection("Desktop Entry")
+	if err != nil {
+		return []error{errors.New("missing [Desktop Entry] group")}, nil
+	}
+
+	for _, section := range desktopFile.Sections() {
+		for _, key := range section.Keys() {
+			if !desktopEntryKeyPattern.MatchString(key.Name()) {
+				warnings = append(warnings, fmt.Errorf("[%s] invalid key %q", section.Name(), key.Name()))
+			}
+		}
+	}
+
+	entryType := desktopEntry.Key("Type").String()
+	switch entryType {
+	case "Application", "Link", "Directory":
+	case "":
+		problems = append(problems, errors.New("[Desktop Entry] missing required key Type"))
+	default:
+		problems = append(problems, fmt.Errorf("[Desktop Entry] invalid Type %q", entryType))
+	}
+	if desktopEntry.Key("Name").String() == "" {
+		problems = append(problems, errors.New("[Desktop Entry] missing required key Name"))
+	}
+
+	for _, key := range []string{"NoDisplay", "Hidden", "DBusActivatable", "Terminal", "StartupNotify", "PrefersNonDefaultGPU", "SingleMainWindow"} {
+		if !desktopEntry.HasKey(key) {
+			continue
+		}
+		value := desktopEntry.Key(key).String()
+		if value != "true" && value != "false" {
+			warnings = append(warnings, fmt.Errorf("[Desktop Entry] %s must be true or false, not %q", key, value))
+		}
+	}
+
+	if entryType == "Application" {
+		exec := desktopEntry.Key("Exec").String()
+		if exec == "" && !desktopEntry.Key("DBusActivatable").MustBool(false) {
+			problems = append(problems, errors.New("[Desktop Entry] missing required key Exec"))
+		} else if exec != "" {
+			if err := validateExec(exec); err != nil {
+				problems = append(problems, fmt.Errorf("[Desktop Entry] invalid Exec, %s", err))
+			}
+		}
+	}
+
+	for _, action := range desktopEntryActions(desktopFile) {
+		sectionName := fmt.Sprintf("Desktop Action %s", action)
+		section, err := desktopFile.GetSection(sectionName)
+		if err != nil {
+			warnings = append(warnings, fmt.Errorf("action %s has no [%s] group", action, sectionName))
+			continue
+		}
+		if section.Key("Name").String() == "" {
+			warnings = append(warnings, fmt.Errorf("[%s] missing required key Name", sectionName))
+		}
+		if section.HasKey("Exec") {
+			if err := validateExec(section.Key("Exec").String()); err != nil {
+				warnings = append(warnings, fmt.Errorf("[%s] invalid Exec, %s", sectionName, err))
+			}
+		}
+	}
+
+	return problems, warnings
+}
+
+// desktopEntryActions returns the identifiers of the actions listed in
+// the Actions key of the desktop entry
+func desktopEntryActions(desktopFile *ini.File) []string {
+	desktopEntry := desktopFile.Section("Desktop Entry")
+	if !desktopEntry.HasKey("Actions") {
+		return nil
+	}
+
+	var actions []string
+	for _, action := range strings.Split(desktopEntry.Key("Actions").String(), ";") {
+		action = strings.TrimSpace(action)
+		if action != "" {
+			actions = append(actions, action)
+		}
+	}
+	return actions
+}
+
+// rewriteDesktopFileExec points the Exec key of the desktop entry, and of
+// every desktop action at program. Actions with an Exec key which cannot
+// be rewritten are removed, as they would launch the AppImage directly
+func rewriteDesktopFileExec(desktopFile *ini.File, program string) error {
+	desktopEntry := desktopFile.Section("Desktop Entry")
+	exec := desktopEntry.Key("Exec").String()
+	if exec == "" {
+		// entries which are only activated through D-Bus
+		// still need to be launched through zap
+		exec = fmt.Sprintf("%s %%U", quoteExecArg(program))
+	} else {
+		var err error
+		exec, err = rewriteExec(exec, program)
+		if err != nil {
+			return fmt.Errorf("[Desktop Entry] invalid Exec, %s", err)
+		}
+	}
+	desktopEntry.Key("Exec").SetValue(exec)
+	desktopEntry.Key("TryExec").SetValue(program)
+
+	// the D-Bus service of the AppImage is not installed, so the
+	// desktop environment has to launch it through Exec
+	desktopEntry.DeleteKey("DBusActivatable")
+
+	var actions []string
+	for _, action := range desktopEntryActions(desktopFile) {
+		section, err := desktopFile.GetSection(fmt.Sprintf("Desktop Action %s", action))
+		if err != nil || !section.HasKey("Exec") {
+			actions = append(actions, action)
+			continue
+		}
+		exec, err := rewriteExec(section.Key("Exec").String(), program)
+		if err != nil {
+			logger.Warnf("Removing the action %s, [%s] invalid Exec, %s", action, section.Name(), err)
+			desktopFile.DeleteSection(section.Name())
+			continue
+		}
+		section.Key("Exec").SetValue(exec)
+		actions = append(actions, action)
+	}
+	if len(actions) != len(desktopEntryActions(desktopFile)) {
+		if len(actions) == 0 {
+			desktopEntry.DeleteKey("Actions")
+		} else {
+			desktopEntry.Key("Actions").SetValue(strings.Join(actions, ";") + ";")
+		}
+	}
+	return nil
+}
+
+// desktopEntryBool returns the value of a boolean key of the desktop
+// entry, without adding the key to it, if it is missing
+func desktopEntryBool(desktopEntry *ini.Section, key string) bool {
+	return desktopEntry.HasKey(key) && desktopEntry.Key(key).String() == "true"
+}
+
+// optsOutOfIntegration returns true if the AppImage has asked not to be
+// integrated with the desktop, with X-AppImage-Integrate=false
+func optsOutOfIntegration(desktopEntry *ini.Section) bool {
+	return desktopEntry.HasKey("X-AppImage-Integrate") &&
+		strings.TrimSpace(desktopEntry.Key("X-AppImage-Integrate").String()) == "false"
+}
+
+// renameDesktopEntry applies template to the Name of the desktop entry, and
+// to its localized Name[xx] keys. %s in template is replaced by the name
+func renameDesktopEntry(desktopEntry *ini.Section, template string) {
+	for _, key := range desktopEntry.Keys() {
+		if key.Name() != "Name" && !strings.HasPrefix(key.Name(), "Name[") {
+			continue
+		}
+		key.SetValue(strings.Replace(template, "%s", key.String(), 1))
+	}
+}
@@ -0,0 +1,168 @@
+package appimage
+
+import (
+	"reflect"
+	"testing"
+
+	"gopkg.in/ini.v1"
+)
+
+func TestSplitExec(t *testing.T) {
+	tests := []struct {
+		name    string
+		exec    string
+		want    []string
+		wantErr bool
+	}{
+		{name: "empty", exec: "", want: nil},
+		{name: "program", exec: "firefox", want: []string{"firefox"}},
+		{name: "field code", exec: "firefox %u", want: []string{"firefox", "%u"}},
+		{name: "repeated spaces and tabs", exec: "firefox  \t--new-window   %U ", want: []string{"firefox", "--new-window", "%U"}},
+		{name: "quoted", exec: `"/opt/My App/app" --flag`, want: []string{"/opt/My App/app", "--flag"}},
+		{name: "quotes inside an argument", exec: `app --name="a b"`, want: []string{"app", "--name=a b"}},
+		{name: "escapes in quotes", exec: "app \"a \\\"b\\\" \\$HOME \\\\ \\`c\\`\"", want: []string{"app", "a \"b\" $HOME \\ `c`"}},
+		{name: "backslash outside quotes", exec: `app a\b`, want: []string{"app", `a\b`}},
+		{name: "unterminated quote", exec: `app "a b`, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			args, err := splitExec(tt.exec)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("splitExec(%q) error = %v, wantErr %v", tt.exec, err, tt.wantErr)
+			}
+			var got []string
+			for _, arg := range args {
+				got = append(got, arg.value)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("splitExec(%q) = %q, want %q", tt.exec, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSplitExecPositions(t *testing.T) {
+	exec := `env A=1 "/opt/My App/app" %F`
+	args, err := splitExec(exec)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"env", "A=1", `"/opt/My App/app"`, "%F"}
+	for i, arg := range args {
+		if raw := exec[arg.start:arg.end]; raw != want[i] {
+			t.Errorf("argument %d is %q in the Exec key, want %q", i, raw, want[i])
+		}
+	}
+	if !args[2].quoted || args[3].quoted {
+		t.Errorf("quoted = %v, %v, want true, false", args[2].quoted, args[3].quoted)
+	}
+}
+
+func TestRewriteExec(t *testing.T) {
+	tests := []struct {
+		name    string
+		exec    string
+		program string
+		want    string
+		wantErr bool
+	}{
+		{name: "empty", exec: "", program: "/home/u/.local/bin/app", want: "/home/u/.local/bin/app"},
+		{name: "program only", exec: "AppRun", program: "/home/u/.local/bin/app", want: "/home/u/.local/bin/app"},
+		{name: "keeps arguments and field codes", exec: "AppRun --new-window %U", program: "/bin/app", want: "/bin/app --new-window %U"},
+		{name: "quoted program", exec: `"/tmp/.mount_x/My App" %f`, program: "/bin/app", want: "/bin/app %f"},
+		{name: "keeps quoted arguments", exec: `app --name="a b" %u`, program: "/bin/app", want: `/bin/app --name="a b" %u`},
+		{name: "quotes the new program", exec: "app %F", program: "/home/my user/.local/bin/app", want: `"/home/my user/.local/bin/app" %F`},
+		{name: "keeps env", exec: "env GDK_BACKEND=x11 A=1 app %U", program: "/bin/app", want: "env GDK_BACKEND=x11 A=1 /bin/app %U"},
+		{name: "env with a path", exec: "/usr/bin/env A=1 app", program: "/bin/app", want: "/usr/bin/env A=1 /bin/app"},
+		{name: "env options", exec: "env -i -u A --unset B --chdir=/tmp A=1 app %U", program: "/bin/app", want: "env -i -u A --unset B --chdir=/tmp A=1 /bin/app %U"},
+		{name: "env option without its value", exec: "env -u", program: "/bin/app", wantErr: true},
+		{name: "env without a program", exec: "env A=1", program: "/bin/app", wantErr: true},
+		{name: "unterminated quote", exec: `"app %U`, program: "/bin/app", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := rewriteExec(tt.exec, tt.program)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("rewriteExec(%q) error = %v, wantErr %v", tt.exec, err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("rewriteExec(%q, %q) = %q, want %q", tt.exec, tt.program, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidateDesktopFile(t *testing.T) {
+	tests := []struct {
+		name         string
+		desktopFile  string
+		wantProblems int
+		wantWarnings int
+	}{
+		{
+			name:        "valid",
+			desktopFile: "[Desktop Entry]\nType=Application\nName=Foo\nName[es_419]=Foo\nName[sr@latin]=Foo\nComment[zh_CN.UTF-8]=Foo\nExec=foo %U\nX-AppImage-Version=1.0\n",
+		},
+		{
+			name:         "odd keys and booleans",
+			desktopFile:  "[Desktop Entry]\nType=Application\nName=Foo\nExec=foo\nX_Foo=bar\nName[]=Foo\nTerminal=True\n",
+			wantWarnings: 3,
+		},
+		{
+			name:         "broken action",
+			desktopFile:  "[Desktop Entry]\nType=Application\nName=Foo\nExec=foo\nActions=New;Missing;\n\n[Desktop Action New]\nExec=foo %x\n",
+			wantWarnings: 3,
+		},
+		{
+			name:         "missing Name and Exec",
+			desktopFile:  "[Desktop Entry]\nType=Application\n",
+			wantProblems: 2,
+		},
+		{
+			name:         "invalid Exec",
+			desktopFile:  "[Desktop Entry]\nType=Application\nName=Foo\nExec=foo %F %U\n",
+			wantProblems: 1,
+		},
+		{
+			name:         "missing group",
+			desktopFile:  "[Desktop Action New]\nName=New\n",
+			wantProblems: 1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			desktopFile, err := ini.LoadSources(ini.LoadOptions{IgnoreInlineComment: true}, []byte(tt.desktopFile))
+			if err != nil {
+				t.Fatal(err)
+			}
+			problems, warnings := validateDesktopFile(desktopFile)
+			if len(problems) != tt.wantProblems || len(warnings) != tt.wantWarnings {
+				t.Errorf("problems = %v, warnings = %v, want %d problems and %d warnings",
+					problems, warnings, tt.wantProblems, tt.wantWarnings)
+			}
+		})
+	}
+}
+
+func TestRewriteDesktopFileExecRemovesBrokenActions(t *testing.T) {
+	desktopFile, err := ini.LoadSources(ini.LoadOptions{IgnoreInlineComment: true}, []byte(
+		"[Desktop Entry]\nName=Foo\nExec=AppRun %U\nActions=New;Broken;\n\n"+
+			"[Desktop Action New]\nName=New\nExec=AppRun --new\n\n"+
+			"[Desktop Action Broken]\nName=Broken\nExec=\"AppRun --broken\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = rewriteDesktopFileExec(desktopFile, "/bin/foo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := desktopFile.Section("Desktop Entry").Key("Actions").String(); got != "New;" {
+		t.Errorf("Actions = %q, want %q", got, "New;")
+	}
+	if _, err := desktopFile.GetSection("Desktop Action Broken"); err == nil {
+		t.Error("the broken action was kept")
+	}
+	if got := desktopFile.Section("Desktop Action New").Key("Exec").String(); got != "/bin/foo --new" {
+		t.Errorf("Exec of New = %q, want %q", got, "/bin/foo --new")
+	}
+}
@@ -0,0 +1,300 @@
+package appimage
+
+import (
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/adrg/xdg"
+	"github.com/srevinsaju/zap/config"
+	"github.com/srevinsaju/zap/daemon"
+	"github.com/srevinsaju/zap/internal/helpers"
+)
+
+const (
+	DoctorOK      = "ok"
+	DoctorWarning = "warning"
+	DoctorError   = "error"
+)
+
+// DoctorCheck is the result of one of the checks of zap doctor
+type DoctorCheck struct {
+	Name    string `json:"name"`
+	Status  string `json:"status"`
+	Message string `json:"message"`
+
+	// Remedy tells the user how to fix the problem, if the check failed
+	Remedy string `json:"remedy,omitempty"`
+}
+
+func doctorOK(name string, message string) DoctorCheck {
+	return DoctorCheck{Name: name, Status: DoctorOK, Message: message}
+}
+
+// Doctor checks the environment zap and the installed appimages run in,
+// and the configuration at configPath
+func Doctor(configPath string) []DoctorCheck {
+	cfg, err := config.NewZapConfig(configPath)
+	checks := []DoctorCheck{checkConfig(configPath, cfg, err)}
+	if err != nil {
+		// the rest is checked against the defaults
+		cfg = config.NewZapDefaultConfig()
+	}
+
+	checks = append(checks, checkFuse(), checkPath())
+	checks = append(checks, checkDirs(*cfg)...)
+	checks = append(checks, checkSystemd()...)
+	checks = append(checks, checkIndex(*cfg))
+	checks = append(checks, checkMirrors(configPath, *cfg)...)
+	return checks
+}
+
+// checkConfig checks that the configuration file could be parsed,
+// and that its values are valid
+func checkConfig(configPath string, cfg *config.Store, err error) DoctorCheck {
+	name := "Configuration"
+	remedy := fmt.Sprintf("Fix %s, or run zap init to write a new configuration", configPath)
+	if err != nil {
+		return DoctorCheck{Name: name, Status: DoctorError, Remedy: remedy,
+			Message: fmt.Sprintf("%s could not be read, %s", configPath, strings.TrimSpace(err.Error()))}
+	}
+	if !helpers.CheckIfFileExists(configPath) {
+		return doctorOK(name, fmt.Sprintf("%s does not exist, the defaults are used", configPath))
+	}
+
+	var problems []string
+	switch cfg.Integrate {
+	case config.IntegrateAlways, config.IntegrateNever, config.IntegrateAsk:
+	default:
+		problems = append(problems, fmt.Sprintf("Integrate is %q, expected one of %s, %s or %s",
+			cfg.Integrate, config.IntegrateAlways, config.IntegrateNever, config.IntegrateAsk))
+	}
+	if !strings.Contains(cfg.DesktopNameTemplate, "%s") {
+		problems = append(problems, fmt.Sprintf("DesktopNameTemplate %q does not contain %%s", cfg.DesktopNameTemplate))
+	}
+	for _, mirror := range cfg.Mirror {
+		if !strings.Contains(mirror, "%s") {
+			problems = append(problems, fmt.Sprintf("Mirror %s does not contain %%s", mirror))
+		}
+	}
+	if cfg.Proxy != "" {
+		if _, err := url.Parse(cfg.Proxy); err != nil {
+			problems = append(problems, fmt.Sprintf("Proxy %s is not a valid URL", cfg.Proxy))
+		}
+	}
+	if cfg.CABundle != "" {
+		pem, err := os.ReadFile(cfg.CABundle)
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("CABundle %s could not be read", cfg.CABundle))
+		} else if !x509.NewCertPool().AppendCertsFromPEM(pem) {
+			problems = append(problems, fmt.Sprintf("CABundle %s does not contain any certificate", cfg.CABundle))
+		}
+	}
+	if cfg.Netrc != "" && !helpers.CheckIfFileExists(cfg.Netrc) {
+		problems = append(problems, fmt.Sprintf("Netrc %s does not exist", cfg.Netrc))
+	}
+	if len(problems) > 0 {
+		return DoctorCheck{Name: name, Status: DoctorError, Remedy: remedy,
+			Message: strings.Join(problems, "; ")}
+	}
+	return doctorOK(name, fmt.Sprintf("%s is valid", configPath))
+}
+
+func checkFuse() DoctorCheck {
+	name := "FUSE"
+	if fuseAvailable() {
+		return doctorOK(name, "AppImages can mount themselves")
+	}
+	return DoctorCheck{
+		Name:    name,
+		Status:  DoctorWarning,
+		Message: "FUSE is not available, AppImages will not start unless they are extracted",
+		Remedy:  "Install libfuse2, or set ExtractAppImages = true in the configuration and reinstall the apps",
+	}
+}
+
+// checkPath checks that the launchers in ~/.local/bin can be found
+func checkPath() DoctorCheck {
+	name := "PATH"
+	binDir := path.Join(xdg.Home, ".local", "bin")
+	realBinDir, err := filepath.EvalSymlinks(binDir)
+	if err != nil {
+		realBinDir = binDir
+	}
+	for _, dir := range filepath.SplitList(os.Getenv("PATH")) {
+		dir = path.Clean(dir)
+		if dir == binDir || dir == realBinDir {
+			return doctorOK(name, fmt.Sprintf("%s is on PATH", binDir))
+		}
+	}
+	return DoctorCheck{
+		Name:    name,
+		Status:  DoctorWarning,
+		Message: fmt.Sprintf("%s is not on PATH, installed apps cannot be run by their name", binDir),
+		Remedy:  "Add export PATH=\"$HOME/.local/bin:$PATH\" to your shell profile, and log in again",
+	}
+}
+
+// checkDirs checks that the directories zap installs into exist,
+// and are writable
+func checkDirs(cfg config.Store) []DoctorCheck {
+	dirs := []struct {
+		name string
+		dir  string
+	}{
+		{"LocalStore", cfg.LocalStore},
+		{"IndexStore", cfg.IndexStore},
+		{"IconStore", cfg.IconStore},
+		{"ApplicationStore", cfg.ApplicationStore},
+		{"CacheStore", cfg.CacheStore},
+		{"XDG_DATA_HOME", xdg.DataHome},
+		{"XDG_CONFIG_HOME", xdg.ConfigHome},
+		{"~/.local/bin", path.Join(xdg.Home, ".local", "bin")},
+	}
+
+	var checks []DoctorCheck
+	for _, d := range dirs {
+		name := fmt.Sprintf("%s directory", d.name)
+
+		// zap creates the directories it needs, so a directory
+		// which does not exist yet only needs a writable parent
+		dir := d.dir
+		for !helpers.CheckIfDirectoryExists(dir) && dir != path.Dir(dir) {
+			dir = path.Dir(dir)
+		}
+		err := checkWritable(dir)
+		if err != nil {
+			checks = append(checks, DoctorCheck{
+				Name:    name,
+				Status:  DoctorError,
+				Message: fmt.Sprintf("%s is not writable, %s", dir, err),
+				Remedy:  fmt.Sprintf("Run sudo chown -R %s %s", os.Getenv("USER"), dir),
+			})
+		} else if dir != d.dir {
+			checks = append(checks, doctorOK(name, fmt.Sprintf("%s will be created when it is needed", d.dir)))
+		} else {
+			checks = append(checks, doctorOK(name, fmt.Sprintf("%s is writable", d.dir)))
+		}
+	}
+	return checks
+}
+
+// checkWritable returns an error if a file cannot be created in dir
+func checkWritable(dir string) error {
+	probe, err := os.CreateTemp(dir, ".zap-doctor-")
+	if err != nil {
+		return err
+	}
+	_ = probe.Close()
+	return os.Remove(probe.Name())
+}
+
+// checkSystemd checks that the user session of systemd is reachable,
+// and that zapd, which updates the apps in the background, is running
+func checkSystemd() []DoctorCheck {
+	if !daemon.CheckIfRunningSystemd() {
+		return []DoctorCheck{{
+			Name:    "systemd",
+			Status:  DoctorWarning,
+			Message: "This system is not running systemd, apps are not updated in the background",
+			Remedy:  "Run zap daemon from your session startup, or zap upgrade periodically",
+		}}
+	}
+
+	err := exec.Command("systemctl", "--user", "show-environment").Run()
+	if err != nil {
+		return []DoctorCheck{{
+			Name:    "systemd",
+			Status:  DoctorWarning,
+			Message: fmt.Sprintf("The systemd user session is not reachable, %s", err),
+			Remedy:  "Log in through a graphical or login session, or run loginctl enable-linger",
+		}}
+	}
+	checks := []DoctorCheck{doctorOK("systemd", "The systemd user session is running")}
+
+	output, _ := exec.Command("systemctl", "--user", "is-active", "zapd").Output()
+	state := strings.TrimSpace(string(output))
+	if state == "active" {
+		checks = append(checks, doctorOK("zapd", "zapd is running"))
+	} else {
+		if state == "" {
+			state = "not installed"
+		}
+		checks = append(checks, DoctorCheck{
+			Name:    "zapd",
+			Status:  DoctorWarning,
+			Message: fmt.Sprintf("zapd is %s, apps are not updated in the background", state),
+			Remedy:  "Run zap daemon --install",
+		})
+	}
+	return checks
+}
+
+// checkIndex checks that the index files of the installed apps can be parsed
+func checkIndex(cfg config.Store) DoctorCheck {
+	name := "Index"
+	indexFiles, err := filepath.Glob(path.Join(cfg.IndexStore, "*.json"))
+	if err != nil {
+		return DoctorCheck{Name: name, Status: DoctorError, Message: err.Error()}
+	}
+
+	var broken []string
+	for _, indexFile := range indexFiles {
+		indexBytes, err := os.ReadFile(indexFile)
+		if err == nil {
+			err = json.Unmarshal(indexBytes, &AppImage{})
+		}
+		if err != nil {
+			logger.Debugf("Failed to parse %s, %s", indexFile, err)
+			broken = append(broken, path.Base(indexFile))
+		}
+	}
+	if len(broken) > 0 {
+		return DoctorCheck{
+			Name:    name,
+			Status:  DoctorError,
+			Message: fmt.Sprintf("%s in %s cannot be parsed", strings.Join(broken, ", "), cfg.IndexStore),
+			Remedy:  "Remove the broken index files, and install the apps again",
+		}
+	}
+	return doctorOK(name, fmt.Sprintf("%d installed apps", len(indexFiles)))
+}
+
+// checkMirrors checks that each of the configured mirrors can be reached.
+// A mirror responding with anything but a server error is reachable
+func checkMirrors(configPath string, cfg config.Store) []DoctorCheck {
+	urls := append([]string{}, cfg.MirrorRoot...)
+	for _, mirror := range cfg.Mirror {
+		urls = append(urls, strings.Replace(mirror, "%s", "zap", 1))
+	}
+
+	var checks []DoctorCheck
+	for _, url := range urls {
+		name := fmt.Sprintf("Mirror %s", url)
+		resp, err := helpers.HTTPClient().Get(url)
+		if err == nil {
+			_ = resp.Body.Close()
+			if resp.StatusCode >= http.StatusInternalServerError {
+				err = fmt.Errorf("unexpected response %s", resp.Status)
+			}
+		}
+		if err != nil {
+			checks = append(checks, DoctorCheck{
+				Name:    name,
+				Status:  DoctorError,
+				Message: fmt.Sprintf("cannot be reached, %s", err),
+				Remedy:  fmt.Sprintf("Check your network connection and Proxy, or change Mirror and MirrorRoot in %s", configPath),
+			})
+			continue
+		}
+		checks = append(checks, doctorOK(name, "reachable"))
+	}
+	return checks
+}
@@ -0,0 +1,136 @@
+package appimage
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/srevinsaju/zap/config"
+	"github.com/srevinsaju/zap/internal/helpers"
+	"github.com/srevinsaju/zap/tui"
+)
+
+// fuseAvailable returns true if AppImages can mount themselves with FUSE,
+// which needs /dev/fuse, fusermount and libfuse.so.2
+func fuseAvailable() bool {
+	if _, err := os.Stat("/dev/fuse"); err != nil {
+		return false
+	}
+	if !commandExists("fusermount") && !commandExists("fusermount3") {
+		return false
+	}
+	if output, err := exec.Command("ldconfig", "-p").Output(); err == nil {
+		return strings.Contains(string(output), "libfuse.so.2")
+	}
+	for _, pattern := range []string{"/lib*/libfuse.so.2", "/usr/lib*/libfuse.so.2", "/lib*/*/libfuse.so.2", "/usr/lib*/*/libfuse.so.2"} {
+		if matches, _ := filepath.Glob(pattern); len(matches) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// suggestExtractMode lets the user know that the appimage will not start,
+// because FUSE is not available
+func suggestExtractMode(executable string) {
+	logger.Warnf("FUSE is not available, %s will probably not start.", executable)
+	fmt.Printf("Install libfuse2, or reinstall %s with %s, which does not need FUSE. "+
+		"Set %s in the configuration to install every AppImage like that.\n",
+		tui.Yellow(executable),
+		tui.Green(fmt.Sprintf("zap install --extract %s", executable)),
+		tui.Green("ExtractAppImages = true"))
+}
+
+// launchTarget returns the file which launches the appimage, AppRun
+// if the appimage is extracted, otherwise the appimage itself
+func (appimage AppImage) launchTarget() string {
+	if appimage.Extracted != "" {
+		return path.Join(appimage.Extracted, "AppRun")
+	}
+	return appimage.Filepath
+}
+
+// extractTree extracts the appimage into LocalStore/<executable>. The tree
+// is extracted next to it first, and LocalStore/<executable> is a symlink
+// to it, which is replaced atomically, so that the app can be launched
+// while it is updated. It returns LocalStore/<executable>
+func (appimage AppImage) extractTree(cfg config.Store) (string, error) {
+	link := path.Join(cfg.LocalStore, appimage.Executable)
+	if link == appimage.Filepath {
+		return "", fmt.Errorf("%s is the appimage itself", link)
+	}
+
+	dir, err := os.MkdirTemp(cfg.LocalStore, fmt.Sprintf(".%s-", appimage.Executable))
+	if err != nil {
+		return "", err
+	}
+
+	logger.Debugf("Extracting %s into %s", appimage.Filepath, dir)
+	cmd := exec.Command(appimage.Filepath, "--appimage-extract")
+	cmd.Dir = dir
+	err = cmd.Run()
+	if err != nil {
+		_ = os.RemoveAll(dir)
+		return "", fmt.Errorf("failed to extract %s, %s", appimage.Filepath, err)
+	}
+	tree := path.Join(dir, "squashfs-root")
+	if !helpers.CheckIfFileExists(path.Join(tree, "AppRun")) {
+		_ = os.RemoveAll(dir)
+		return "", fmt.Errorf("%s has no AppRun", appimage.Filepath)
+	}
+	err = os.Chmod(dir, 0755)
+	if err != nil {
+		logger.Debugf("Failed to change the permissions of %s, %s", dir, err)
+	}
+
+	previousTree, _ := os.Readlink(link)
+
+	newLink := fmt.Sprintf("%s.new", link)
+	_ = os.Remove(newLink)
+	err = os.Symlink(tree, newLink)
+	if err == nil {
+		err = os.Rename(newLink, link)
+	}
+	if err != nil {
+		_ = os.Remove(newLink)
+		_ = os.RemoveAll(dir)
+		return "", err
+	}
+
+	if previousTree != "" && previousTree != tree {
+		removeTree(previousTree, cfg)
+	}
+	return link, nil
+}
+
+// removeTree removes an extracted tree, which is within LocalStore
+func removeTree(tree string, cfg config.Store) {
+	dir := path.Dir(tree)
+	if path.Dir(dir) != path.Clean(cfg.LocalStore) {
+		logger.Debugf("Not removing %s, it is not in %s", dir, cfg.LocalStore)
+		return
+	}
+	logger.Debugf("Removing extracted tree, %s", dir)
+	err := os.RemoveAll(dir)
+	if err != nil {
+		logger.Warnf("Failed to remove %s, %s", dir, err)
+	}
+}
+
+// removeExtractedTree removes the extracted tree of the appimage, and
+// LocalStore/<executable>, which links to it
+func (appimage AppImage) removeExtractedTree(cfg config.Store) {
+	if appimage.Extracted == "" {
+		return
+	}
+	tree, err := os.Readlink(appimage.Extracted)
+	if err != nil {
+		logger.Debugf("%s is not a link to an extracted tree, %s", appimage.Extracted, err)
+		return
+	}
+	removeTree(tree, cfg)
+	_ = os.Remove(appimage.Extracted)
+}
@@ -0,0 +1,243 @@
+package appimage
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/srevinsaju/zap/config"
+	"github.com/srevinsaju/zap/internal/helpers"
+	"github.com/srevinsaju/zap/tui"
+)
+
+// tempDirPattern matches the names of the temporary directories
+// zap creates with os.MkdirTemp
+var tempDirPattern = regexp.MustCompile(`^zap(-bundle)?[0-9]+$`)
+
+// gcGracePeriod is how long files are left alone after they were last
+// modified, as they could belong to a zap which is still running
+const gcGracePeriod = time.Hour
+
+// garbage is a file or directory left behind by zap
+type garbage struct {
+	path   string
+	reason string
+	size   int64
+}
+
+// diskUsage returns the size of the files in p, without following symlinks
+func diskUsage(p string) int64 {
+	var size int64
+	_ = filepath.Walk(p, func(_ string, info os.FileInfo, err error) error {
+		if err == nil && info.Mode().IsRegular() {
+			size += info.Size()
+		}
+		return nil
+	})
+	return size
+}
+
+// isAppImageFile returns true if the file at p is an ELF executable
+// with the magic bytes of an appimage
+func isAppImageFile(p string) bool {
+	f, err := os.Open(p)
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+
+	header := make([]byte, 11)
+	_, err = io.ReadFull(f, header)
+	if err != nil {
+		return false
+	}
+	return bytes.Equal(header[:4], []byte("\x7fELF")) &&
+		(bytes.Equal(header[8:], []byte("AI\x01")) || bytes.Equal(header[8:], []byte("AI\x02")))
+}
+
+// isRecent returns true if info was modified within gcGracePeriod
+func isRecent(info os.FileInfo) bool {
+	return time.Since(info.ModTime()) < gcGracePeriod
+}
+
+// findGarbage returns the files and directories left behind by zap, like
+// temporary files of interrupted updates, and appimages and extracted trees,
+// which are not in the index
+func findGarbage(cfg config.Store) ([]garbage, error) {
+	apps, err := List(cfg, false)
+	if err != nil {
+		return nil, err
+	}
+
+	// the files which are recorded in the index are in use. The paths in
+	// the index may be out of date, if the home directory has moved, so
+	// they are relocated, and the names of the files are matched as well
+	inUse := map[string]bool{}
+	inUseNames := map[string]bool{}
+	use := func(p string) {
+		if p == "" {
+			return
+		}
+		inUse[path.Clean(p)] = true
+		if realPath, err := filepath.EvalSymlinks(p); err == nil {
+			inUse[realPath] = true
+		}
+		inUseNames[path.Base(p)] = true
+	}
+	var missing []string
+	for _, executable := range apps {
+		app, err := loadIndex(executable, cfg)
+		if err != nil {
+			// without the index, it is not known
+			// which of the files are orphans
+			return nil, fmt.Errorf("failed to read the index of %s, %s", executable, err)
+		}
+		relocated := *app
+		relocated.relocate(cfg)
+		for _, a := range []AppImage{*app, relocated} {
+			use(a.Filepath)
+			use(a.IconPath)
+			use(a.DesktopFile)
+			if a.DesktopFile != "" {
+				// with UseXdgDesktopMenu, the index records the desktop
+				// file xdg-desktop-menu installed, not the staged copy
+				use(path.Join(cfg.LocalStore, "desktop", path.Base(a.DesktopFile)))
+			}
+			use(a.Extracted)
+			if tree, err := os.Readlink(a.Extracted); err == nil {
+				use(path.Dir(tree))
+			}
+		}
+		if !helpers.CheckIfFileExists(relocated.Filepath) {
+			missing = append(missing, executable)
+		}
+	}
+	if len(missing) > 0 {
+		// the appimages which are not found may be
+		// among those which look like orphans
+		logger.Warnf("The AppImages of %s do not exist, AppImages are not removed, run zap repair first",
+			strings.Join(missing, ", "))
+	}
+
+	var found []garbage
+	add := func(p string, info os.FileInfo, reason string) {
+		if inUse[p] || isRecent(info) {
+			return
+		}
+		found = append(found, garbage{path: p, reason: reason, size: diskUsage(p)})
+	}
+
+	localStore := path.Clean(cfg.LocalStore)
+	entries, err := os.ReadDir(localStore)
+	if err != nil {
+		return nil, err
+	}
+	for _, entry := range entries {
+		p := path.Join(localStore, entry.Name())
+		info, err := os.Lstat(p)
+		if err != nil || inUseNames[entry.Name()] {
+			continue
+		}
+		switch {
+		case info.Mode().IsRegular() && strings.HasPrefix(entry.Name(), "temp") && strings.HasSuffix(entry.Name(), ".AppImage"):
+			add(p, info, "left behind by an interrupted update")
+		case info.Mode().IsRegular() && isAppImageFile(p):
+			if len(missing) == 0 {
+				add(p, info, "not installed")
+			}
+		case info.Mode()&os.ModeSymlink != 0:
+			// LocalStore/<executable> links to the extracted tree
+			tree, err := os.Readlink(p)
+			if err == nil && strings.HasPrefix(tree, localStore+"/.") {
+				add(p, info, "link to an extracted tree which is not installed")
+			}
+		case info.IsDir() && strings.HasPrefix(entry.Name(), ".") &&
+			strings.Contains(entry.Name(), "-") && helpers.CheckIfDirectoryExists(path.Join(p, "squashfs-root")):
+			add(p, info, "extracted tree which is not installed")
+		}
+	}
+
+	// copies of desktop files staged for xdg-desktop-menu
+	desktopFiles, _ := filepath.Glob(path.Join(localStore, "desktop", "*.desktop"))
+	for _, desktopFile := range desktopFiles {
+		if info, err := os.Lstat(desktopFile); err == nil {
+			add(desktopFile, info, "staged desktop file")
+		}
+	}
+
+	// icons extracted from appimages which are not installed
+	icons, _ := filepath.Glob(path.Join(cfg.IconStore, "*"))
+	for _, icon := range icons {
+		if info, err := os.Lstat(icon); err == nil && info.Mode().IsRegular() && !inUseNames[path.Base(icon)] {
+			add(icon, info, "icon of an appimage which is not installed")
+		}
+	}
+
+	// older versions of zap symlinked the icons in IconStore
+	// into the hicolor icon theme
+	_ = filepath.Walk(hicolorDir(), func(p string, info os.FileInfo, err error) error {
+		if err != nil || info.Mode()&os.ModeSymlink == 0 {
+			return nil
+		}
+		target, err := os.Readlink(p)
+		if err != nil || (!strings.HasPrefix(target, localStore) && !strings.HasPrefix(target, cfg.IconStore)) {
+			return nil
+		}
+		if _, err := os.Stat(p); os.IsNotExist(err) {
+			found = append(found, garbage{path: p, reason: "icon which does not exist"})
+		}
+		return nil
+	})
+
+	// temporary directories appimages were extracted into
+	tmpDirs, _ := filepath.Glob(path.Join(os.TempDir(), "zap*"))
+	for _, tmpDir := range tmpDirs {
+		info, err := os.Lstat(tmpDir)
+		if err != nil || !info.IsDir() || !tempDirPattern.MatchString(info.Name()) {
+			continue
+		}
+		if stat, ok := info.Sys().(*syscall.Stat_t); ok && int(stat.Uid) != os.Getuid() {
+			continue
+		}
+		add(tmpDir, info, "temporary directory")
+	}
+	return found, nil
+}
+
+// GC removes the files and directories zap has left behind, or only lists
+// them if dryRun is true, and returns the space they take up
+func GC(config config.Store, dryRun bool) (int64, error) {
+	found, err := findGarbage(config)
+	if err != nil {
+		return 0, err
+	}
+
+	var reclaimed int64
+	removedIcons := false
+	for _, g := range found {
+		if !dryRun {
+			logger.Debugf("Removing %s", g.path)
+			err := os.RemoveAll(g.path)
+			if err != nil {
+				logger.Warnf("Failed to remove %s, %s", g.path, err)
+				continue
+			}
+			if strings.HasPrefix(g.path, hicolorDir()) {
+				removedIcons = true
+			}
+		}
+		reclaimed += g.size
+		fmt.Printf("%s %s (%s, %s)\n", tui.Blue("[gc]"), g.path, tui.Yellow(g.reason), tui.HumanizeBytes(g.size))
+	}
+	if removedIcons {
+		refreshIconTheme()
+	}
+	return reclaimed, nil
+}
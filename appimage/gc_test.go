@@ -0,0 +1,69 @@
+package appimage
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/srevinsaju/zap/config"
+)
+
+func TestFindGarbageKeepsStagedDesktopFiles(t *testing.T) {
+	dir := t.TempDir()
+	cfg := config.Store{
+		LocalStore:       filepath.Join(dir, "zap"),
+		IndexStore:       filepath.Join(dir, "zap", "index"),
+		IconStore:        filepath.Join(dir, "zap", "icons"),
+		ApplicationStore: filepath.Join(dir, "applications"),
+	}
+	for _, d := range []string{cfg.IndexStore, cfg.IconStore, cfg.ApplicationStore, filepath.Join(cfg.LocalStore, "desktop")} {
+		if err := os.MkdirAll(d, 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// installed with UseXdgDesktopMenu, the index records the
+	// desktop file xdg-desktop-menu installed
+	app := AppImage{
+		Filepath:    filepath.Join(cfg.LocalStore, "Foo.AppImage"),
+		Executable:  "foo",
+		DesktopFile: filepath.Join(cfg.ApplicationStore, "foo.desktop"),
+	}
+	indexBytes, err := json.Marshal(app)
+	if err != nil {
+		t.Fatal(err)
+	}
+	old := time.Now().Add(-2 * gcGracePeriod)
+	files := map[string][]byte{
+		filepath.Join(cfg.IndexStore, "foo.json"): indexBytes,
+		app.Filepath:    nil,
+		app.DesktopFile: nil,
+		filepath.Join(cfg.LocalStore, "desktop", "foo.desktop"): nil,
+		filepath.Join(cfg.LocalStore, "desktop", "bar.desktop"): nil,
+	}
+	for file, data := range files {
+		if err := os.WriteFile(file, data, 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chtimes(file, old, old); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	found, err := findGarbage(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var staged []string
+	for _, g := range found {
+		if strings.HasPrefix(g.path, filepath.Join(cfg.LocalStore, "desktop")) {
+			staged = append(staged, filepath.Base(g.path))
+		}
+	}
+	if len(staged) != 1 || staged[0] != "bar.desktop" {
+		t.Errorf("staged desktop files found = %v, want only bar.desktop", staged)
+	}
+}
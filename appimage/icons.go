@@ -0,0 +1,414 @@
+package appimage
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"image"
+	_ "image/png"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/adrg/xdg"
+	"github.com/srevinsaju/zap/internal/helpers"
+)
+
+// hicolorSizes are the sizes of the directories of the hicolor
+// icon theme, which icons of other sizes are installed into
+var hicolorSizes = []int{16, 22, 24, 32, 36, 48, 64, 72, 96, 128, 192, 256, 512}
+
+// iconSuffixes maps the suffixes of icons to their flag in
+// the GTK icon cache
+var iconSuffixes = map[string]uint16{
+	".xpm": 1,
+	".svg": 2,
+	".png": 4,
+}
+
+// hicolorDir returns the hicolor icon theme of the user
+func hicolorDir() string {
+	return path.Join(xdg.DataHome, "icons", "hicolor")
+}
+
+// hicolorSizeDir returns the directory of the hicolor icon theme for
+// an icon which is width pixels wide
+func hicolorSizeDir(width int) string {
+	size := hicolorSizes[len(hicolorSizes)-1]
+	for _, s := range hicolorSizes {
+		if s >= width {
+			size = s
+			break
+		}
+	}
+	return fmt.Sprintf("%dx%d", size, size)
+}
+
+// iconThemeName returns the name of Icon in a desktop file, if it refers
+// to an icon of the icon theme, and not to a file
+func iconThemeName(icon string) string {
+	if strings.Contains(icon, "/") {
+		return ""
+	}
+	for suffix := range iconSuffixes {
+		icon = strings.TrimSuffix(icon, suffix)
+	}
+	return icon
+}
+
+// appIconName returns the name which the icon of the app is installed
+// as into the hicolor icon theme, so that it does not conflict with the
+// icons of other packages
+func (appimage AppImage) appIconName() string {
+	return fmt.Sprintf("zap-%s", appimage.Executable)
+}
+
+// installIcons installs every icon in usr/share/icons/hicolor of the AppImage
+// into the hicolor icon theme of the user. icon is the Icon of the desktop
+// file, the icons of the app are renamed to appIconName. If the AppImage
+// does not ship its icon in the hicolor theme, .DirIcon is used instead.
+// It returns true if the icon of the app was installed
+func (appimage *AppImage) installIcons(icon string) bool {
+	iconName := iconThemeName(icon)
+	appIconInstalled := false
+
+	dir, err := os.MkdirTemp("", "zap")
+	if err != nil {
+		logger.Debug("Creating temporary directory for icon extraction failed")
+		return false
+	}
+	defer os.RemoveAll(dir)
+
+	icons := appimage.ExtractAll(dir, "usr/share/icons/hicolor/*")
+	var relPaths []string
+	for rel := range icons {
+		relPaths = append(relPaths, rel)
+	}
+	sort.Strings(relPaths)
+
+	for _, rel := range relPaths {
+		// usr/share/icons/hicolor/<size>/<context>/<name><suffix>
+		parts := strings.Split(rel, "/")
+		if len(parts) != 7 {
+			continue
+		}
+		size, context, fileName := parts[4], parts[5], parts[6]
+		if _, ok := iconSuffixes[path.Ext(fileName)]; !ok {
+			continue
+		}
+		name := strings.TrimSuffix(fileName, path.Ext(fileName))
+
+		targetName := name
+		if context == "apps" {
+			switch name {
+			case iconName:
+				targetName = appimage.appIconName()
+				appIconInstalled = true
+			case fmt.Sprintf("%s-symbolic", iconName):
+				targetName = fmt.Sprintf("%s-symbolic", appimage.appIconName())
+			default:
+				targetName = fmt.Sprintf("%s-%s", appimage.appIconName(), name)
+			}
+		}
+		// icons of other contexts, like the icons of MIME types, are
+		// looked up by their name, so they keep it
+
+		target := path.Join(hicolorDir(), size, context, targetName+path.Ext(fileName))
+		if targetName == name && helpers.CheckIfFileExists(target) && !appimage.ownsIcon(target) {
+			logger.Debugf("Not replacing %s, which belongs to another app", target)
+			continue
+		}
+		appimage.installIcon(icons[rel], target)
+	}
+
+	if !appIconInstalled && appimage.IconPath != "" {
+		// fallback to .DirIcon, which was copied to the icon store
+		target := ""
+		switch path.Ext(appimage.IconPath) {
+		case ".svg":
+			target = path.Join(hicolorDir(), "scalable", "apps", appimage.appIconName()+".svg")
+		case ".png":
+			f, err := os.Open(appimage.IconPath)
+			if err != nil {
+				logger.Debug(err)
+				break
+			}
+			im, _, err := image.DecodeConfig(f)
+			f.Close()
+			if err != nil {
+				logger.Debugf("Failed to read the dimensions of %s, %s", appimage.IconPath, err)
+				break
+			}
+			target = path.Join(hicolorDir(), hicolorSizeDir(im.Width), "apps", appimage.appIconName()+".png")
+		}
+		if target != "" && appimage.installIcon(appimage.IconPath, target) {
+			appIconInstalled = true
+		}
+	}
+
+	refreshIconTheme()
+	return appIconInstalled
+}
+
+// installIcon copies the icon to target, and records it in the index
+func (appimage *AppImage) installIcon(icon string, target string) bool {
+	logger.Debugf("Installing icon %s", target)
+	err := os.MkdirAll(path.Dir(target), 0755)
+	if err != nil {
+		logger.Warnf("Failed to create %s, %s", path.Dir(target), err)
+		return false
+	}
+	_, err = helpers.CopyFile(icon, target)
+	if err != nil {
+		logger.Warnf("Failed to install icon %s, %s", target, err)
+		return false
+	}
+	if !appimage.ownsIcon(target) {
+		appimage.Icons = append(appimage.Icons, target)
+	}
+	return true
+}
+
+func (appimage AppImage) ownsIcon(icon string) bool {
+	for _, i := range appimage.Icons {
+		if i == icon {
+			return true
+		}
+	}
+	return false
+}
+
+// uninstallIcons removes the icons installed into the hicolor icon theme
+func (appimage *AppImage) uninstallIcons() {
+	// indexes written by older versions of zap only
+	// symlinked .DirIcon into the hicolor theme
+	if appimage.IconPathHicolor != "" {
+		logger.Debugf("Removing symlink to hicolor theme, %s", appimage.IconPathHicolor)
+		_ = os.Remove(appimage.IconPathHicolor)
+		appimage.IconPathHicolor = ""
+	}
+	if len(appimage.Icons) == 0 {
+		return
+	}
+	for _, icon := range appimage.Icons {
+		logger.Debugf("Removing icon, %s", icon)
+		_ = os.Remove(icon)
+	}
+	appimage.Icons = nil
+	refreshIconTheme()
+}
+
+// refreshIconTheme lets desktop environments know that the hicolor icon
+// theme of the user has changed, and regenerates its icon cache
+func refreshIconTheme() {
+	hicolor := hicolorDir()
+	if !helpers.CheckIfDirectoryExists(hicolor) {
+		return
+	}
+
+	// desktop environments watch the modification time
+	// of the theme to reload icons
+	now := time.Now()
+	err := os.Chtimes(hicolor, now, now)
+	if err != nil {
+		logger.Debugf("Failed to touch %s, %s", hicolor, err)
+	}
+
+	err = updateIconCache(hicolor)
+	if err != nil {
+		logger.Warnf("Failed to update the icon cache of %s, %s", hicolor, err)
+	}
+}
+
+// iconCacheHash is the hash function of the GTK icon cache
+func iconCacheHash(name string) uint32 {
+	if name == "" {
+		return 0
+	}
+	// names are hashed as signed chars
+	h := uint32(int32(int8(name[0])))
+	for i := 1; i < len(name); i++ {
+		h = (h << 5) - h + uint32(int32(int8(name[i])))
+	}
+	return h
+}
+
+// updateIconCache writes icon-theme.cache into the icon theme at dir, like
+// gtk-update-icon-cache does. Without an up-to-date cache, GTK ignores the
+// cache and scans the theme on every lookup
+func updateIconCache(dir string) error {
+	var directories []string
+	directoryIndex := map[string]uint16{}
+	icons := map[string]map[uint16]uint16{}
+
+	err := filepath.Walk(dir, func(file string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			return nil
+		}
+		flag, ok := iconSuffixes[path.Ext(file)]
+		if !ok {
+			return nil
+		}
+		rel, err := filepath.Rel(dir, filepath.Dir(file))
+		if err != nil || rel == "." {
+			return nil
+		}
+		index, ok := directoryIndex[rel]
+		if !ok {
+			index = uint16(len(directories))
+			directoryIndex[rel] = index
+			directories = append(directories, rel)
+		}
+		name := strings.TrimSuffix(info.Name(), path.Ext(file))
+		if icons[name] == nil {
+			icons[name] = map[uint16]uint16{}
+		}
+		icons[name][index] |= flag
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	var names []string
+	for name := range icons {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	nBuckets := uint32(len(names)/2 + 1)
+	buckets := make([][]string, nBuckets)
+	for _, name := range names {
+		bucket := iconCacheHash(name) % nBuckets
+		buckets[bucket] = append(buckets[bucket], name)
+	}
+
+	// the layout of the cache is the header, followed by the hash table,
+	// the icons, their names and images, and the list of directories
+	const (
+		headerSize = 12
+		iconSize   = 12
+		none       = 0xffffffff
+	)
+	var b bytes.Buffer
+	write := func(data interface{}) {
+		_ = binary.Write(&b, binary.BigEndian, data)
+	}
+	hashOffset := uint32(headerSize)
+	offset := hashOffset + 4 + 4*nBuckets
+
+	// offsets of the icons, their names and image lists
+	iconOffsets := map[string]uint32{}
+	nameOffsets := map[string]uint32{}
+	imageListOffsets := map[string]uint32{}
+	for _, name := range names {
+		iconOffsets[name] = offset
+		offset += iconSize
+	}
+	for _, name := range names {
+		nameOffsets[name] = offset
+		offset += uint32(len(name) + 1)
+		offset = (offset + 3) &^ 3
+	}
+	for _, name := range names {
+		imageListOffsets[name] = offset
+		offset += 4 + 8*uint32(len(icons[name]))
+	}
+	directoryListOffset := offset
+	offset += 4 + 4*uint32(len(directories))
+	directoryOffsets := make([]uint32, len(directories))
+	for i, directory := range directories {
+		directoryOffsets[i] = offset
+		offset += uint32(len(directory) + 1)
+		offset = (offset + 3) &^ 3
+	}
+
+	pad := func() {
+		for b.Len()%4 != 0 {
+			b.WriteByte(0)
+		}
+	}
+
+	// header
+	write(uint16(1))
+	write(uint16(0))
+	write(hashOffset)
+	write(directoryListOffset)
+
+	// hash table
+	write(nBuckets)
+	for _, bucket := range buckets {
+		if len(bucket) == 0 {
+			write(uint32(none))
+		} else {
+			write(iconOffsets[bucket[0]])
+		}
+	}
+
+	// icons, chained by bucket
+	next := map[string]uint32{}
+	for _, bucket := range buckets {
+		for i, name := range bucket {
+			next[name] = none
+			if i+1 < len(bucket) {
+				next[name] = iconOffsets[bucket[i+1]]
+			}
+		}
+	}
+	for _, name := range names {
+		write(next[name])
+		write(nameOffsets[name])
+		write(imageListOffsets[name])
+	}
+	for _, name := range names {
+		b.WriteString(name)
+		b.WriteByte(0)
+		pad()
+	}
+	for _, name := range names {
+		var indexes []int
+		for index := range icons[name] {
+			indexes = append(indexes, int(index))
+		}
+		sort.Ints(indexes)
+		write(uint32(len(indexes)))
+		for _, index := range indexes {
+			// the directory, the flags, and the offset of the image data,
+			// which is not cached
+			write(uint16(index))
+			write(icons[name][uint16(index)])
+			write(uint32(0))
+		}
+	}
+
+	// directories
+	write(uint32(len(directories)))
+	for _, directoryOffset := range directoryOffsets {
+		write(directoryOffset)
+	}
+	for _, directory := range directories {
+		b.WriteString(directory)
+		b.WriteByte(0)
+		pad()
+	}
+
+	if uint32(b.Len()) != offset {
+		return fmt.Errorf("icon cache has size %d, expected %d", b.Len(), offset)
+	}
+
+	cacheFile := path.Join(dir, "icon-theme.cache")
+	err = writeFileAtomic(cacheFile, b.Bytes(), 0644)
+	if err != nil {
+		return err
+	}
+	// GTK ignores the cache if it is older than the theme directory,
+	// which was just modified by renaming the cache into it
+	now := time.Now()
+	return os.Chtimes(cacheFile, now, now)
+}
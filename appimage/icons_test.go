@@ -0,0 +1,159 @@
+package appimage
+
+import (
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestIconCacheHash(t *testing.T) {
+	tests := []struct {
+		name string
+		want uint32
+	}{
+		{name: "", want: 0},
+		{name: "a", want: 97},
+		{name: "ab", want: 97*31 + 98},
+		// non-ASCII bytes are hashed as signed chars
+		{name: "\xe9", want: 0xffffffe9},
+		{name: "a\xe9", want: 97*31 - 23},
+	}
+	for _, tt := range tests {
+		if got := iconCacheHash(tt.name); got != tt.want {
+			t.Errorf("iconCacheHash(%q) = %d, want %d", tt.name, got, tt.want)
+		}
+	}
+}
+
+// lookupIconCache finds name in an icon cache the way GTK does, and
+// returns the directories it is in, with its flags
+func lookupIconCache(t *testing.T, cache []byte, name string) map[string]uint16 {
+	u16 := func(offset uint32) uint16 {
+		if int(offset)+2 > len(cache) {
+			t.Fatalf("offset %d is outside of the cache", offset)
+		}
+		return binary.BigEndian.Uint16(cache[offset:])
+	}
+	u32 := func(offset uint32) uint32 {
+		if int(offset)+4 > len(cache) {
+			t.Fatalf("offset %d is outside of the cache", offset)
+		}
+		return binary.BigEndian.Uint32(cache[offset:])
+	}
+	str := func(offset uint32) string {
+		end := offset
+		for int(end) < len(cache) && cache[end] != 0 {
+			end++
+		}
+		return string(cache[offset:end])
+	}
+
+	if major, minor := u16(0), u16(2); major != 1 || minor != 0 {
+		t.Fatalf("cache version is %d.%d, want 1.0", major, minor)
+	}
+	hashOffset := u32(4)
+	directoryListOffset := u32(8)
+
+	nBuckets := u32(hashOffset)
+	icon := u32(hashOffset + 4 + 4*(iconCacheHash(name)%nBuckets))
+	for icon != 0xffffffff {
+		if str(u32(icon+4)) != name {
+			icon = u32(icon)
+			continue
+		}
+		found := map[string]uint16{}
+		imageList := u32(icon + 8)
+		for i := uint32(0); i < u32(imageList); i++ {
+			directory := u16(imageList + 4 + 8*i)
+			flags := u16(imageList + 4 + 8*i + 2)
+			found[str(u32(directoryListOffset+4+4*uint32(directory)))] = flags
+		}
+		return found
+	}
+	return nil
+}
+
+func TestUpdateIconCache(t *testing.T) {
+	files := []string{
+		"48x48/apps/zap-firefox.png",
+		"scalable/apps/zap-firefox.svg",
+		"scalable/apps/zap-firefox-symbolic.svg",
+		"256x256/apps/zap-element.png",
+		"48x48/apps/zap-element.png",
+		"48x48/apps/zap-element.xpm",
+		"32x32/mimetypes/application-x-zap.png",
+		"48x48/apps/README.txt",
+		"index.theme",
+	}
+	// a number of icons which fills some buckets with more than one icon
+	for _, name := range []string{"a", "b", "c", "d", "e", "f", "g", "h", "i", "j"} {
+		files = append(files, filepath.Join("16x16/apps", name+".png"))
+	}
+
+	dir := t.TempDir()
+	for _, file := range files {
+		file = filepath.Join(dir, file)
+		if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(file, nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := updateIconCache(dir); err != nil {
+		t.Fatal(err)
+	}
+	cache, err := os.ReadFile(filepath.Join(dir, "icon-theme.cache"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		want map[string]uint16
+	}{
+		{name: "zap-firefox", want: map[string]uint16{"48x48/apps": 4, "scalable/apps": 2}},
+		{name: "zap-firefox-symbolic", want: map[string]uint16{"scalable/apps": 2}},
+		{name: "zap-element", want: map[string]uint16{"256x256/apps": 4, "48x48/apps": 4 | 1}},
+		{name: "application-x-zap", want: map[string]uint16{"32x32/mimetypes": 4}},
+		{name: "a", want: map[string]uint16{"16x16/apps": 4}},
+		{name: "j", want: map[string]uint16{"16x16/apps": 4}},
+		{name: "README", want: nil},
+		{name: "index", want: nil},
+		{name: "zap-missing", want: nil},
+	}
+	for _, tt := range tests {
+		if got := lookupIconCache(t, cache, tt.name); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("icon %s is in %v, want %v", tt.name, got, tt.want)
+		}
+	}
+
+	info, err := os.Stat(filepath.Join(dir, "icon-theme.cache"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	dirInfo, err := os.Stat(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.ModTime().Before(dirInfo.ModTime()) {
+		t.Errorf("the cache is older than the theme, GTK would ignore it")
+	}
+}
+
+func TestUpdateIconCacheEmptyTheme(t *testing.T) {
+	dir := t.TempDir()
+	if err := updateIconCache(dir); err != nil {
+		t.Fatal(err)
+	}
+	cache, err := os.ReadFile(filepath.Join(dir, "icon-theme.cache"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := lookupIconCache(t, cache, "zap-firefox"); got != nil {
+		t.Errorf("icon zap-firefox is in %v, want nowhere", got)
+	}
+}
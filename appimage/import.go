@@ -0,0 +1,212 @@
+package appimage
+
+import (
+	"crypto/md5"
+	"fmt"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/adrg/xdg"
+	"github.com/srevinsaju/zap/config"
+	"github.com/srevinsaju/zap/tui"
+	"github.com/srevinsaju/zap/types"
+	"gopkg.in/ini.v1"
+)
+
+const (
+	ImportAppImageLauncher = "appimagelauncher"
+	ImportAppimaged        = "appimaged"
+)
+
+// legacyIdPattern matches the names of the desktop files and icons, which
+// AppImageLauncher and appimaged install, like appimagekit_<md5>-Name.desktop.
+// The md5 is the md5 of the URI of the appimage
+var legacyIdPattern = regexp.MustCompile(`^appimagekit_([0-9a-f]{32})`)
+
+// legacyIntegration is an appimage managed by AppImageLauncher or appimaged
+type legacyIntegration struct {
+	appImage string
+
+	// id is the md5 in the names of the files they installed for it
+	id string
+
+	// desktopFile is the desktop file they installed, if it was integrated
+	desktopFile string
+}
+
+// legacyId returns the id AppImageLauncher and appimaged use for the
+// appimage at file, the md5 of its URI, like the thumbnail specification
+func legacyId(file string) string {
+	uri := url.URL{Scheme: "file", Path: file}
+	return fmt.Sprintf("%x", md5.Sum([]byte(uri.String())))
+}
+
+// importDirs returns the directories in the home directory, which tool
+// keeps appimages in
+func importDirs(tool string) ([]string, error) {
+	switch tool {
+	case ImportAppImageLauncher:
+		destination := path.Join(xdg.Home, "Applications")
+		cfg, err := ini.Load(path.Join(xdg.ConfigHome, "appimagelauncher.cfg"))
+		if err == nil && cfg.Section("AppImageLauncher").HasKey("destination") {
+			destination = cfg.Section("AppImageLauncher").Key("destination").String()
+			if strings.HasPrefix(destination, "~/") {
+				destination = path.Join(xdg.Home, destination[2:])
+			}
+		}
+		return []string{destination}, nil
+	case ImportAppimaged:
+		var dirs []string
+		for _, dir := range []string{"Applications", "Downloads", "Desktop", "bin", ".local/bin"} {
+			dirs = append(dirs, path.Join(xdg.Home, dir))
+		}
+		return dirs, nil
+	}
+	return nil, fmt.Errorf("cannot import from %s, expected %s or %s", tool, ImportAppImageLauncher, ImportAppimaged)
+}
+
+// legacyDesktopFileAppImage returns the appimage, which a desktop file
+// installed by AppImageLauncher or appimaged launches
+func legacyDesktopFileAppImage(desktopFile string) string {
+	cfg, err := ini.LoadSources(ini.LoadOptions{IgnoreInlineComment: true}, desktopFile)
+	if err != nil {
+		logger.Debugf("Failed to parse %s, %s", desktopFile, err)
+		return ""
+	}
+	desktopEntry := cfg.Section("Desktop Entry")
+	candidates := []string{desktopEntry.Key("TryExec").String()}
+	// the appimage may be launched through a wrapper,
+	// like firejail --appimage
+	candidates = append(candidates, strings.Fields(desktopEntry.Key("Exec").String())...)
+	for _, candidate := range candidates {
+		candidate = strings.Trim(candidate, `"'`)
+		if path.IsAbs(candidate) && isAppImageCandidate(candidate) {
+			return candidate
+		}
+	}
+	return ""
+}
+
+// findLegacyIntegrations returns the appimages managed by tool, those it
+// integrated, and those in the directories it keeps appimages in
+func findLegacyIntegrations(tool string, cfg config.Store) ([]legacyIntegration, error) {
+	dirs, err := importDirs(tool)
+	if err != nil {
+		return nil, err
+	}
+
+	var found []legacyIntegration
+	seen := map[string]bool{}
+
+	// they install their desktop files into ~/.local/share/applications,
+	// even if zap is configured to install them elsewhere
+	desktopFiles, _ := filepath.Glob(path.Join(xdg.DataHome, "applications", "appimagekit_*.desktop"))
+	for _, desktopFile := range desktopFiles {
+		match := legacyIdPattern.FindStringSubmatch(path.Base(desktopFile))
+		if match == nil {
+			logger.Debugf("Skipping %s, it has no id", desktopFile)
+			continue
+		}
+		appImage := legacyDesktopFileAppImage(desktopFile)
+		if appImage == "" || seen[appImage] {
+			continue
+		}
+		seen[appImage] = true
+		found = append(found, legacyIntegration{
+			appImage:    appImage,
+			id:          match[1],
+			desktopFile: desktopFile,
+		})
+	}
+
+	localStore := path.Clean(cfg.LocalStore)
+	for _, dir := range dirs {
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			continue
+		}
+		for _, entry := range entries {
+			appImage := path.Join(dir, entry.Name())
+			// the launchers zap creates in ~/.local/bin are symlinks
+			if entry.Type()&os.ModeSymlink != 0 || seen[appImage] || strings.HasPrefix(appImage, localStore+"/") {
+				continue
+			}
+			if !isAppImageCandidate(appImage) || isLauncherScript(appImage) {
+				continue
+			}
+			seen[appImage] = true
+			found = append(found, legacyIntegration{appImage: appImage, id: legacyId(appImage)})
+		}
+	}
+	return found, nil
+}
+
+// unintegrate removes the desktop file, icons and MIME packages, which
+// AppImageLauncher or appimaged installed for the appimage
+func (legacy legacyIntegration) unintegrate() {
+	var files []string
+	if legacy.desktopFile != "" {
+		files = append(files, legacy.desktopFile)
+	}
+	_ = filepath.Walk(path.Join(xdg.DataHome, "icons"), func(p string, info os.FileInfo, err error) error {
+		if err == nil && !info.IsDir() && strings.HasPrefix(info.Name(), fmt.Sprintf("appimagekit_%s", legacy.id)) {
+			files = append(files, p)
+		}
+		return nil
+	})
+	mimePackages, _ := filepath.Glob(path.Join(mimeDir(), "packages", fmt.Sprintf("appimagekit_%s*", legacy.id)))
+	files = append(files, mimePackages...)
+
+	for _, file := range files {
+		logger.Debugf("Removing %s", file)
+		err := os.Remove(file)
+		if err != nil {
+			logger.Warnf("Failed to remove %s, %s", file, err)
+		}
+	}
+}
+
+// Import installs the appimages managed by AppImageLauncher or appimaged,
+// where they are. The appimages they integrated are integrated by zap, and
+// their own desktop files and icons are removed, if unintegrate is true
+func Import(tool string, unintegrate bool, config config.Store) error {
+	found, err := findLegacyIntegrations(tool, config)
+	if err != nil {
+		return err
+	}
+	if len(found) == 0 {
+		fmt.Printf("No AppImages managed by %s were found\n", tui.Yellow(tool))
+		return nil
+	}
+
+	unintegrated := false
+	for _, legacy := range found {
+		err := Adopt(legacy.appImage, types.AdoptOptions{Integrate: legacy.desktopFile != ""}, config)
+		if err != nil {
+			fmt.Printf("%s%s %s\n", tui.Blue("[import]"), tui.Red(fmt.Sprintf("[%s]", path.Base(legacy.appImage))), tui.Yellow(err))
+			continue
+		}
+		if unintegrate {
+			legacy.unintegrate()
+			unintegrated = true
+		} else if legacy.desktopFile != "" {
+			fmt.Printf("%s%s %s is still installed, use --unintegrate to remove it\n", tui.Blue("[import]"),
+				tui.Yellow(fmt.Sprintf("[%s]", path.Base(legacy.appImage))), legacy.desktopFile)
+		}
+	}
+	if unintegrated {
+		refreshDesktopDatabase(config)
+		refreshIconTheme()
+		err = updateMimeDatabase(mimeDir())
+		if err != nil {
+			logger.Warnf("Failed to update the MIME database, %s", err)
+		}
+	}
+
+	fmt.Printf("Uninstall %s, or stop it, so that it does not integrate the AppImages again\n", tui.Yellow(tool))
+	return nil
+}
@@ -0,0 +1,49 @@
+package appimage
+
+import "testing"
+
+func TestLegacyId(t *testing.T) {
+	tests := []struct {
+		file string
+		want string
+	}{
+		// md5 of file:///home/u/Applications/Foo.AppImage
+		{file: "/home/u/Applications/Foo.AppImage", want: "17b694b0cd8fc816e5a13117096b0cc2"},
+		// md5 of file:///home/u/My%20Apps/Foo%20Bar.AppImage
+		{file: "/home/u/My Apps/Foo Bar.AppImage", want: "043fc80b5b7b24e1c12d47eab642c043"},
+		// md5 of file:///home/u/Apps/%C3%89moji%231.AppImage
+		{file: "/home/u/Apps/Émoji#1.AppImage", want: "b4a9386d496ea3ac9f4f6f4230f019ea"},
+	}
+	for _, tt := range tests {
+		got := legacyId(tt.file)
+		if got != tt.want {
+			t.Errorf("legacyId(%q) = %s, want %s", tt.file, got, tt.want)
+		}
+		match := legacyIdPattern.FindStringSubmatch("appimagekit_" + got + "-Foo.desktop")
+		if match == nil || match[1] != got {
+			t.Errorf("legacyIdPattern does not match the id %s", got)
+		}
+	}
+}
+
+func TestLegacyIdPattern(t *testing.T) {
+	tests := []struct {
+		name string
+		want string
+	}{
+		{name: "appimagekit_17b694b0cd8fc816e5a13117096b0cc2-Foo.desktop", want: "17b694b0cd8fc816e5a13117096b0cc2"},
+		{name: "appimagekit_17b694b0cd8fc816e5a13117096b0cc2_foo.png", want: "17b694b0cd8fc816e5a13117096b0cc2"},
+		{name: "appimagekit_XYZ-Foo.desktop", want: ""},
+		{name: "appimagekit_17b694b0-Foo.desktop", want: ""},
+		{name: "foo.desktop", want: ""},
+	}
+	for _, tt := range tests {
+		got := ""
+		if match := legacyIdPattern.FindStringSubmatch(tt.name); match != nil {
+			got = match[1]
+		}
+		if got != tt.want {
+			t.Errorf("id of %s is %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
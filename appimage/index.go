@@ -0,0 +1,83 @@
+package appimage
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+	"syscall"
+
+	"github.com/srevinsaju/zap/config"
+	"github.com/srevinsaju/zap/exceptions"
+	"github.com/srevinsaju/zap/internal/helpers"
+)
+
+// indexFilePath returns the path of the index file, which describes
+// the installation of executable
+func indexFilePath(executable string, config config.Store) string {
+	return fmt.Sprintf("%s.json", path.Join(config.IndexStore, executable))
+}
+
+// loadIndex reads the index file of an installed app. It returns
+// exceptions.NotInstalledError if the app is not installed
+func loadIndex(executable string, config config.Store) (*AppImage, error) {
+	indexFile := indexFilePath(executable, config)
+	logger.Debugf("Checking if %s exists", indexFile)
+	if !helpers.CheckIfFileExists(indexFile) {
+		return nil, exceptions.NotInstalledError
+	}
+
+	logger.Debugf("Unmarshalling JSON from %s", indexFile)
+	indexBytes, err := os.ReadFile(indexFile)
+	if err != nil {
+		return nil, err
+	}
+	app := &AppImage{}
+	err = json.Unmarshal(indexBytes, app)
+	if err != nil {
+		return nil, err
+	}
+	return app, nil
+}
+
+// saveIndex writes the index file of app
+func saveIndex(app *AppImage, config config.Store) error {
+	unlock, err := lockIndex(config)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	return writeIndex(app, config)
+}
+
+// writeIndex replaces the index file of app. The caller holds the
+// lock of the index
+func writeIndex(app *AppImage, config config.Store) error {
+	indexBytes, err := json.Marshal(*app)
+	if err != nil {
+		return err
+	}
+	indexFile := indexFilePath(app.Executable, config)
+	logger.Debugf("Writing JSON index to %s", indexFile)
+	return writeFileAtomic(indexFile, indexBytes, 0644)
+}
+
+// lockIndex takes an exclusive lock on the index, so that an update
+// of an index file is not lost to a concurrent one. The lock file is
+// kept outside of IndexStore, where every file is an installed app
+func lockIndex(config config.Store) (unlock func(), err error) {
+	lockFile := path.Join(config.LocalStore, ".index.lock")
+	f, err := os.OpenFile(lockFile, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, err
+	}
+	err = syscall.Flock(int(f.Fd()), syscall.LOCK_EX)
+	if err != nil {
+		_ = f.Close()
+		return nil, err
+	}
+	return func() {
+		_ = syscall.Flock(int(f.Fd()), syscall.LOCK_UN)
+		_ = f.Close()
+	}, nil
+}
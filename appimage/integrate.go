@@ -0,0 +1,234 @@
+package appimage
+
+import (
+	"errors"
+	"fmt"
+	"path"
+	"path/filepath"
+
+	"github.com/adrg/xdg"
+	"github.com/srevinsaju/zap/config"
+	"github.com/srevinsaju/zap/tui"
+	"gopkg.in/ini.v1"
+)
+
+const (
+	IntegrationEnabled  = "enabled"
+	IntegrationDisabled = "disabled"
+)
+
+// isIntegrated returns true if the appimage is integrated with the desktop.
+// Indexes written by older versions of zap do not record the integration
+func (appimage AppImage) isIntegrated() bool {
+	if appimage.Integration != "" {
+		return appimage.Integration == IntegrationEnabled
+	}
+	return appimage.DesktopFile != ""
+}
+
+// errNotShown is returned by integrate, if the desktop file is not
+// installed, because it would not be shown by the desktop anyway
+var errNotShown = errors.New("its desktop file is hidden, or not shown in the menu and does not support any MIME type")
+
+// integrate installs the icons, desktop file and MIME packages of the
+// appimage. The appimage is only recorded as integrated, if its desktop
+// file was installed
+func (appimage *AppImage) integrate(cfg config.Store, desktopFile *ini.File) error {
+	desktopEntry := desktopFile.Section("Desktop Entry")
+	desktopEntry.Key("X-Zap-Id").SetValue(appimage.Executable)
+
+	// launch the entry, and its actions through the launcher in ~/.local/bin
+	binDir := path.Join(xdg.Home, ".local", "bin")
+	binFile := path.Join(binDir, appimage.Executable)
+	err := rewriteDesktopFileExec(desktopFile, binFile)
+	if err != nil {
+		return err
+	}
+
+	problems, warnings := validateDesktopFile(desktopFile)
+	for _, warning := range warnings {
+		logger.Warnf("The desktop file of %s is not valid, but usable, %s", appimage.Executable, warning)
+	}
+	if len(problems) > 0 {
+		for _, problem := range problems {
+			logger.Warn(problem)
+		}
+		return errors.New("its desktop file is not valid")
+	}
+
+	if desktopEntryBool(desktopEntry, "Hidden") {
+		logger.Debugf("Not installing the desktop file of %s, it is hidden", appimage.Executable)
+		return errNotShown
+	}
+
+	// terminal apps are launched from ~/.local/bin, and
+	// are kept out of the menu, unless configured
+	if desktopEntryBool(desktopEntry, "Terminal") && !cfg.ShowTerminalApps {
+		desktopEntry.Key("NoDisplay").SetValue("true")
+	}
+
+	// apps which are not shown in the menu, only need
+	// a desktop file to open the MIME types they support
+	supportsMimeTypes := desktopEntry.HasKey("MimeType") && desktopEntry.Key("MimeType").String() != ""
+	if desktopEntryBool(desktopEntry, "NoDisplay") && !supportsMimeTypes {
+		logger.Debugf("Not installing the desktop file of %s, it is not shown in the menu, "+
+			"and does not support any MIME type", appimage.Executable)
+		return errNotShown
+	}
+
+	appImageIcon := desktopEntry.Key("Icon").String()
+	appIconInstalled := appimage.installIcons(appImageIcon)
+
+	// This does patch https://github.com/srevinsaju/zap/issues/92
+	// but, we use zap's saved icon for custom icon theme
+	if cfg.CustomIconTheme {
+		desktopEntry.Key("Icon").SetValue(appImageIcon)
+	} else if appIconInstalled {
+		desktopEntry.Key("Icon").SetValue(appimage.appIconName())
+	} else {
+		desktopEntry.Key("Icon").SetValue(appimage.IconPath)
+	}
+
+	// set the name again, so that the name looks like
+	// Name = appimagetool (AppImage)
+	// as an identifier
+	renameDesktopEntry(desktopEntry, cfg.DesktopNameTemplate)
+
+	targetDesktopFile, err := installDesktopFile(cfg, desktopFile, appimage.Executable)
+	if err != nil {
+		return fmt.Errorf("its desktop file could not be installed, %s", err)
+	}
+	appimage.DesktopFile = targetDesktopFile
+	appimage.Integration = IntegrationEnabled
+
+	appimage.installMimePackages()
+
+	// and they completed, happily ever after
+	logger.Debugf("Desktop file successfully installed to %s", targetDesktopFile)
+	return nil
+}
+
+// removeIntegration removes everything installed by integrate. The
+// default applications set for the appimage are kept if keepSettings is
+// true, because the appimage is integrated again right after
+func (appimage *AppImage) removeIntegration(cfg config.Store, keepSettings bool) {
+	if appimage.DesktopFile != "" {
+		logger.Debugf("Removing desktop file, %s", appimage.DesktopFile)
+		uninstallDesktopFile(cfg, appimage.DesktopFile)
+
+		if !keepSettings {
+			err := removeDefaults(filepath.Base(appimage.DesktopFile))
+			if err != nil {
+				logger.Warnf("Failed to remove default applications, %s", err)
+			}
+		}
+		appimage.DesktopFile = ""
+	}
+	appimage.uninstallMimePackages()
+	appimage.uninstallIcons()
+}
+
+// Integrate integrates an installed app with the desktop, even if it was
+// not integrated when it was installed
+func Integrate(executable string, config config.Store) error {
+	app, err := loadIndex(executable, config)
+	if err != nil {
+		return err
+	}
+
+	desktopFile, err := app.loadDesktopFile()
+	if err != nil {
+		return err
+	}
+
+	// integrate from scratch, so that changes to the
+	// configuration are applied
+	app.removeIntegration(config, true)
+	err = app.integrate(config, desktopFile)
+	if err != nil {
+		return fmt.Errorf("%s could not be integrated, %s", executable, err)
+	}
+
+	err = app.refreshLauncher(config)
+	if err != nil {
+		logger.Warnf("Failed to update the launcher of %s, %s", executable, err)
+	}
+
+	err = saveIndex(app, config)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("%s%s Integrated.\n", tui.Blue("[integrate]"), tui.Green(fmt.Sprintf("[%s]", executable)))
+	return nil
+}
+
+// Unintegrate removes the desktop file, icons and MIME packages of an
+// installed app. The app stays unintegrated across updates
+func Unintegrate(executable string, config config.Store) error {
+	app, err := loadIndex(executable, config)
+	if err != nil {
+		return err
+	}
+
+	app.removeIntegration(config, false)
+	app.Integration = IntegrationDisabled
+
+	err = saveIndex(app, config)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("%s%s Unintegrated.\n", tui.Blue("[integrate]"), tui.Green(fmt.Sprintf("[%s]", executable)))
+	return nil
+}
+
+// IntegrateAll integrates every installed app again, which is integrated,
+// so that changes to the configuration, like CustomIconTheme, are applied
+func IntegrateAll(config config.Store) error {
+	apps, err := List(config, false)
+	if err != nil {
+		return err
+	}
+	for _, executable := range apps {
+		app, err := loadIndex(executable, config)
+		if err != nil {
+			fmt.Printf("%s%s %s\n", tui.Blue("[integrate]"), tui.Red(fmt.Sprintf("[%s]", executable)), tui.Yellow(err))
+			continue
+		}
+		if !app.isIntegrated() {
+			fmt.Printf("%s%s Not integrated, skipping.\n", tui.Blue("[integrate]"), tui.Yellow(fmt.Sprintf("[%s]", executable)))
+			continue
+		}
+		err = Integrate(executable, config)
+		if err != nil {
+			fmt.Printf("%s%s Failed to integrate, %s\n", tui.Blue("[integrate]"), tui.Red(fmt.Sprintf("[%s]", executable)), tui.Yellow(err))
+		}
+	}
+	return nil
+}
+
+// UnintegrateAll unintegrates every installed app
+func UnintegrateAll(config config.Store) error {
+	apps, err := List(config, false)
+	if err != nil {
+		return err
+	}
+	for _, executable := range apps {
+		err = Unintegrate(executable, config)
+		if err != nil {
+			fmt.Printf("%s%s Failed to unintegrate, %s\n", tui.Blue("[integrate]"), tui.Red(fmt.Sprintf("[%s]", executable)), tui.Yellow(err))
+		}
+	}
+	return nil
+}
+
+// carryOver copies the choices the user made for a previous version of the
+// appimage, which are kept when the appimage is updated
+func (appimage *AppImage) carryOver(previous *AppImage) {
+	appimage.Integration = previous.Integration
+	appimage.Autostart = previous.Autostart
+	appimage.Launch = previous.Launch
+	appimage.LastRun = previous.LastRun
+	appimage.LaunchCount = previous.LaunchCount
+	appimage.Sandbox = previous.Sandbox
+	appimage.Portable = previous.Portable
+}
@@ -0,0 +1,303 @@
+package appimage
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/adrg/xdg"
+	"github.com/srevinsaju/zap/config"
+	"github.com/srevinsaju/zap/tui"
+)
+
+// launcherMarker is the second line of the launcher scripts written by zap,
+// which identifies them as zap's, when they are replaced or removed
+const launcherMarker = "# generated by zap, do not edit, use zap launch instead"
+
+var envNamePattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// LaunchConfig configures how an appimage is launched from ~/.local/bin,
+// and from its desktop file
+type LaunchConfig struct {
+	// Args are passed to the appimage before the arguments of the user
+	Args []string `json:"args,omitempty"`
+
+	// Env are environment variables, as NAME=value
+	Env []string `json:"env,omitempty"`
+
+	// WorkingDir is the directory the appimage is launched in
+	WorkingDir string `json:"working_dir,omitempty"`
+}
+
+// IsEmpty returns true if the appimage is launched as is
+func (launch LaunchConfig) IsEmpty() bool {
+	return len(launch.Args) == 0 && len(launch.Env) == 0 && launch.WorkingDir == ""
+}
+
+// Validate checks the environment variables and the working directory
+func (launch LaunchConfig) Validate() error {
+	for _, env := range launch.Env {
+		name := strings.SplitN(env, "=", 2)[0]
+		if !strings.Contains(env, "=") || !envNamePattern.MatchString(name) {
+			return fmt.Errorf("invalid environment variable %q, expected NAME=value", env)
+		}
+	}
+	if launch.WorkingDir != "" && !filepath.IsAbs(launch.WorkingDir) {
+		return fmt.Errorf("working directory %s is not an absolute path", launch.WorkingDir)
+	}
+	return nil
+}
+
+// binFilePath returns the launcher of executable in ~/.local/bin
+func binFilePath(executable string) string {
+	return path.Join(xdg.Home, ".local", "bin", executable)
+}
+
+// shellQuote quotes s for POSIX shells
+func shellQuote(s string) string {
+	return fmt.Sprintf("'%s'", strings.ReplaceAll(s, "'", `'"'"'`))
+}
+
+// isLauncherScript returns true if file is a launcher script written by zap
+func isLauncherScript(file string) bool {
+	info, err := os.Lstat(file)
+	if err != nil || !info.Mode().IsRegular() {
+		return false
+	}
+	f, err := os.Open(file)
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+
+	header := make([]byte, 256)
+	n, _ := f.Read(header)
+	return bytes.Contains(header[:n], []byte(launcherMarker))
+}
+
+// launchCommand returns the command which launches the appimage, in its
+// sandbox, if any, without the arguments of the user
+func (appimage AppImage) launchCommand() ([]string, error) {
+	var command []string
+	if appimage.Sandbox != "" {
+		sandbox, err := appimage.sandboxCommand(appimage.Sandbox)
+		if err != nil {
+			return nil, err
+		}
+		command = sandbox
+	}
+	command = append(command, appimage.launchTarget())
+	return append(command, appimage.Launch.Args...), nil
+}
+
+// launchEnv returns the environment variables the appimage is launched
+// with, apart from ARGV0 and OWD, which depend on how it is launched
+func (appimage AppImage) launchEnv() []string {
+	env := appimage.Launch.Env
+	if appimage.Extracted != "" {
+		// these are set by the AppImage runtime, which
+		// is skipped when launching AppRun directly
+		runtimeEnv := []string{
+			fmt.Sprintf("APPDIR=%s", appimage.Extracted),
+			fmt.Sprintf("APPIMAGE=%s", appimage.Filepath),
+		}
+		if appimage.Portable {
+			dirs := portableDirs(appimage.Filepath)
+			runtimeEnv = append(runtimeEnv,
+				fmt.Sprintf("HOME=%s", dirs[0]),
+				fmt.Sprintf("XDG_CONFIG_HOME=%s", dirs[1]),
+			)
+		}
+		env = append(runtimeEnv, env...)
+	}
+	return env
+}
+
+// launcherScript returns a shell script, which launches the appimage with
+// its launch configuration
+func (appimage AppImage) launcherScript() ([]byte, error) {
+	command, err := appimage.launchCommand()
+	if err != nil {
+		return nil, err
+	}
+
+	var b bytes.Buffer
+	b.WriteString("#!/bin/sh\n")
+	b.WriteString(launcherMarker + "\n")
+	if appimage.Extracted != "" {
+		// like the AppImage runtime, before changing the directory
+		b.WriteString("export ARGV0=\"$0\" OWD=\"$PWD\"\n")
+	}
+	if appimage.Launch.WorkingDir != "" {
+		fmt.Fprintf(&b, "cd %s || exit 1\n", shellQuote(appimage.Launch.WorkingDir))
+	}
+	for _, env := range appimage.launchEnv() {
+		parts := strings.SplitN(env, "=", 2)
+		fmt.Fprintf(&b, "export %s=%s\n", parts[0], shellQuote(parts[1]))
+	}
+	b.WriteString("exec")
+	for _, arg := range command {
+		b.WriteString(" " + shellQuote(arg))
+	}
+	b.WriteString(" \"$@\"\n")
+	return b.Bytes(), nil
+}
+
+// zapCommand returns the path of zap, which the launchers run. The zap on
+// PATH is preferred to the running one, which may be a temporary build, or
+// be replaced by another version elsewhere
+func zapCommand() (string, error) {
+	if zap, err := exec.LookPath("zap"); err == nil {
+		return filepath.Abs(zap)
+	}
+	return os.Executable()
+}
+
+// trackingLauncherScript returns a shell script, which launches the
+// appimage through zap run, to record its usage
+func (appimage AppImage) trackingLauncherScript() ([]byte, error) {
+	zap, err := zapCommand()
+	if err != nil {
+		return nil, err
+	}
+	var b bytes.Buffer
+	b.WriteString("#!/bin/sh\n")
+	b.WriteString(launcherMarker + "\n")
+	fmt.Fprintf(&b, "exec %s run %s -- \"$@\"\n", shellQuote(zap), shellQuote(appimage.Executable))
+	return b.Bytes(), nil
+}
+
+// launcher returns the launcher script of the appimage, or nil if its
+// launcher is a symlink to the appimage. It is a symlink, unless the
+// appimage has a launch configuration, is sandboxed, is extracted, or
+// is launched through zap run
+func (appimage AppImage) launcher(cfg config.Store) ([]byte, error) {
+	if cfg.TrackUsage {
+		return appimage.trackingLauncherScript()
+	}
+	if appimage.Launch.IsEmpty() && appimage.Sandbox == "" && appimage.Extracted == "" {
+		return nil, nil
+	}
+	return appimage.launcherScript()
+}
+
+// installLauncher creates the launcher of the appimage at binFile.
+// binFile must not exist
+func (appimage AppImage) installLauncher(binFile string, cfg config.Store) error {
+	script, err := appimage.launcher(cfg)
+	if err != nil {
+		return err
+	}
+	if script == nil {
+		logger.Debugf("Creating symlink to %s", binFile)
+		return os.Symlink(appimage.Filepath, binFile)
+	}
+	logger.Debugf("Creating launcher script %s", binFile)
+	return writeFileAtomic(binFile, script, 0755)
+}
+
+// ownsLauncher returns true if binFile is a launcher of the appimage
+// created by zap, a launcher script, or a symlink into LocalStore, or
+// to the appimage, if it was adopted where it is
+func (appimage AppImage) ownsLauncher(binFile string, cfg config.Store) bool {
+	if isLauncherScript(binFile) {
+		return true
+	}
+	// the appimage may have been deleted already
+	if target, err := os.Readlink(binFile); err == nil && target == appimage.Filepath {
+		return true
+	}
+	binAbsPath, err := filepath.EvalSymlinks(binFile)
+	if err != nil {
+		return false
+	}
+	if strings.HasPrefix(binAbsPath, cfg.LocalStore) {
+		return true
+	}
+	appImagePath, err := filepath.EvalSymlinks(appimage.Filepath)
+	return err == nil && binAbsPath == appImagePath
+}
+
+// refreshLauncher replaces the launcher of the appimage, so that it
+// follows changes to the appimage, and to the configuration
+func (appimage AppImage) refreshLauncher(cfg config.Store) error {
+	binFile := binFilePath(appimage.Executable)
+	if _, err := os.Lstat(binFile); err == nil {
+		// symlinks which do not resolve can be replaced as well
+		_, err := filepath.EvalSymlinks(binFile)
+		if err == nil && !appimage.ownsLauncher(binFile, cfg) {
+			return fmt.Errorf("%s was not created by zap, refusing to replace it", binFile)
+		}
+		err = os.Remove(binFile)
+		if err != nil {
+			return err
+		}
+	}
+	return appimage.installLauncher(binFile, cfg)
+}
+
+// removeLauncher removes the launcher of the appimage from ~/.local/bin,
+// if it was created by zap
+func (appimage AppImage) removeLauncher(config config.Store) {
+	binFile := binFilePath(appimage.Executable)
+	if appimage.ownsLauncher(binFile, config) {
+		// this link points to config.LocalStore, where all AppImages are stored
+		// I guess we need to remove them, no asking and all
+		// make sure we remove the file first to prevent conflicts in future
+		_ = os.Remove(binFile)
+	}
+}
+
+// SetLaunchConfig stores the launch configuration of an installed app, and
+// recreates its launcher
+func SetLaunchConfig(executable string, launch LaunchConfig, config config.Store) error {
+	err := launch.Validate()
+	if err != nil {
+		return err
+	}
+
+	app, err := loadIndex(executable, config)
+	if err != nil {
+		return err
+	}
+
+	app.Launch = launch
+	err = app.refreshLauncher(config)
+	if err != nil {
+		return err
+	}
+
+	err = saveIndex(app, config)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("✨ Launch configuration of %s saved\n", tui.Green(executable))
+	return nil
+}
+
+// ShowLaunchConfig prints the launch configuration of an installed app
+func ShowLaunchConfig(executable string, config config.Store) error {
+	app, err := loadIndex(executable, config)
+	if err != nil {
+		return err
+	}
+	if app.Launch.IsEmpty() {
+		fmt.Printf("%s is launched without any arguments or environment variables\n", tui.Green(executable))
+		return nil
+	}
+	for _, arg := range app.Launch.Args {
+		fmt.Printf("%s %s\n", tui.Blue("arg"), arg)
+	}
+	for _, env := range app.Launch.Env {
+		fmt.Printf("%s %s\n", tui.Blue("env"), env)
+	}
+	if app.Launch.WorkingDir != "" {
+		fmt.Printf("%s %s\n", tui.Blue("working-dir"), app.Launch.WorkingDir)
+	}
+	return nil
+}
@@ -0,0 +1,357 @@
+package appimage
+
+import (
+	"encoding/xml"
+	"fmt"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/adrg/xdg"
+	"github.com/srevinsaju/zap/internal/helpers"
+)
+
+const sharedMimeInfoNamespace = "http://www.freedesktop.org/standards/shared-mime-info"
+
+// mimePackage is a shared-mime-info package, as found in
+// usr/share/mime/packages
+type mimePackage struct {
+	MimeTypes []mimeTypeDefinition `xml:"mime-type"`
+}
+
+type mimeTypeDefinition struct {
+	Type          string        `xml:"type,attr"`
+	Globs         []mimeGlob    `xml:"glob"`
+	GlobDeleteAll *struct{}     `xml:"glob-deleteall"`
+	SubClassOf    []mimeTypeRef `xml:"sub-class-of"`
+	Aliases       []mimeTypeRef `xml:"alias"`
+	Icon          *mimeIcon     `xml:"icon"`
+	GenericIcon   *mimeIcon     `xml:"generic-icon"`
+	InnerXML      string        `xml:",innerxml"`
+}
+
+type mimeGlob struct {
+	Pattern       string `xml:"pattern,attr"`
+	Weight        string `xml:"weight,attr"`
+	CaseSensitive string `xml:"case-sensitive,attr"`
+}
+
+type mimeTypeRef struct {
+	Type string `xml:"type,attr"`
+}
+
+type mimeIcon struct {
+	Name string `xml:"name,attr"`
+}
+
+// mimeDatabase is the merged content of all the packages of a
+// MIME database directory
+type mimeDatabase struct {
+	types   map[string]*mimeTypeEntry
+	aliases map[string]string
+	globs   []mimeGlobEntry
+}
+
+type mimeTypeEntry struct {
+	parents     []string
+	icon        string
+	genericIcon string
+	innerXML    []string
+}
+
+type mimeGlobEntry struct {
+	mimeType      string
+	pattern       string
+	weight        int
+	caseSensitive bool
+}
+
+// mimeDir returns the MIME database of the user
+func mimeDir() string {
+	return path.Join(xdg.DataHome, "mime")
+}
+
+func parseMimePackage(file string) (*mimePackage, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	pkg := &mimePackage{}
+	err = xml.Unmarshal(data, pkg)
+	if err != nil {
+		return nil, err
+	}
+	return pkg, nil
+}
+
+// installMimePackages copies the shared-mime-info packages of the AppImage
+// into the MIME database of the user, and rebuilds it
+func (appimage *AppImage) installMimePackages() {
+	dir, err := os.MkdirTemp("", "zap")
+	if err != nil {
+		logger.Debug("Creating temporary directory for MIME package extraction failed")
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	packages := appimage.ExtractAll(dir, "usr/share/mime/packages/*.xml")
+	if len(packages) == 0 {
+		logger.Debugf("%s does not provide any MIME packages", appimage.Executable)
+		return
+	}
+
+	packagesDir := path.Join(mimeDir(), "packages")
+	err = os.MkdirAll(packagesDir, 0755)
+	if err != nil {
+		logger.Warnf("Failed to create %s, %s", packagesDir, err)
+		return
+	}
+
+	var relPaths []string
+	for rel := range packages {
+		relPaths = append(relPaths, rel)
+	}
+	sort.Strings(relPaths)
+
+	for _, rel := range relPaths {
+		_, err := parseMimePackage(packages[rel])
+		if err != nil {
+			logger.Warnf("Skipping invalid MIME package %s, %s", rel, err)
+			continue
+		}
+
+		// packages are prefixed with the name of the app, so that they
+		// do not replace the packages of other apps
+		target := path.Join(packagesDir, fmt.Sprintf("zap-%s-%s", appimage.Executable, path.Base(rel)))
+		logger.Debugf("Installing MIME package %s to %s", rel, target)
+		_, err = helpers.CopyFile(packages[rel], target)
+		if err != nil {
+			logger.Warnf("Failed to install MIME package %s, %s", rel, err)
+			continue
+		}
+		appimage.MimePackages = append(appimage.MimePackages, target)
+	}
+
+	if len(appimage.MimePackages) == 0 {
+		return
+	}
+	err = updateMimeDatabase(mimeDir())
+	if err != nil {
+		logger.Warnf("Failed to update the MIME database, %s", err)
+	}
+}
+
+// uninstallMimePackages removes the MIME packages installed by
+// installMimePackages, and rebuilds the MIME database
+func (appimage *AppImage) uninstallMimePackages() {
+	if len(appimage.MimePackages) == 0 {
+		return
+	}
+	for _, pkg := range appimage.MimePackages {
+		logger.Debugf("Removing MIME package, %s", pkg)
+		_ = os.Remove(pkg)
+	}
+	appimage.MimePackages = nil
+
+	err := updateMimeDatabase(mimeDir())
+	if err != nil {
+		logger.Warnf("Failed to update the MIME database, %s", err)
+	}
+}
+
+// updateMimeDatabase rebuilds the MIME database in dir from the packages
+// in dir/packages with update-mime-database, or like it does, if it is not
+// installed. Then, only the plain text files of the database are written,
+// which every implementation of the shared-mime-info specification reads
+// when mime.cache does not exist. Magic rules are not compiled, so the
+// files which cannot be rebuilt, like mime.cache and magic, are kept
+func updateMimeDatabase(dir string) error {
+	if commandExists("update-mime-database") {
+		output, err := exec.Command("update-mime-database", dir).CombinedOutput()
+		if err != nil {
+			return fmt.Errorf("update-mime-database failed, %s, %s", err, strings.TrimSpace(string(output)))
+		}
+		return nil
+	}
+
+	if !helpers.CheckIfDirectoryExists(dir) {
+		return nil
+	}
+	packagesDir := path.Join(dir, "packages")
+	files, err := filepath.Glob(path.Join(packagesDir, "*.xml"))
+	if err != nil {
+		return err
+	}
+	// Override.xml is meant for the user to override every other package
+	sort.SliceStable(files, func(i, j int) bool {
+		if path.Base(files[j]) == "Override.xml" {
+			return path.Base(files[i]) != "Override.xml"
+		}
+		if path.Base(files[i]) == "Override.xml" {
+			return false
+		}
+		return files[i] < files[j]
+	})
+
+	db := &mimeDatabase{
+		types:   map[string]*mimeTypeEntry{},
+		aliases: map[string]string{},
+	}
+	for _, file := range files {
+		pkg, err := parseMimePackage(file)
+		if err != nil {
+			logger.Warnf("Skipping invalid MIME package %s, %s", file, err)
+			continue
+		}
+		db.add(pkg)
+	}
+
+	if helpers.CheckIfFileExists(path.Join(dir, "mime.cache")) {
+		// it is preferred over the text files written below
+		logger.Warnf("%s is out of date, install update-mime-database (shared-mime-info) to update it",
+			path.Join(dir, "mime.cache"))
+	}
+	return db.write(dir)
+}
+
+func (db *mimeDatabase) add(pkg *mimePackage) {
+	for _, definition := range pkg.MimeTypes {
+		if strings.Count(definition.Type, "/") != 1 || strings.Contains(definition.Type, "..") {
+			logger.Debugf("Skipping invalid MIME type %q", definition.Type)
+			continue
+		}
+
+		entry, ok := db.types[definition.Type]
+		if !ok {
+			entry = &mimeTypeEntry{}
+			db.types[definition.Type] = entry
+		}
+
+		if definition.GlobDeleteAll != nil {
+			var globs []mimeGlobEntry
+			for _, glob := range db.globs {
+				if glob.mimeType != definition.Type {
+					globs = append(globs, glob)
+				}
+			}
+			db.globs = globs
+		}
+		for _, glob := range definition.Globs {
+			weight, err := strconv.Atoi(glob.Weight)
+			if err != nil {
+				weight = 50
+			}
+			db.globs = append(db.globs, mimeGlobEntry{
+				mimeType:      definition.Type,
+				pattern:       glob.Pattern,
+				weight:        weight,
+				caseSensitive: glob.CaseSensitive == "true",
+			})
+		}
+
+		for _, parent := range definition.SubClassOf {
+			entry.parents = append(entry.parents, parent.Type)
+		}
+		for _, alias := range definition.Aliases {
+			db.aliases[alias.Type] = definition.Type
+		}
+		if definition.Icon != nil {
+			entry.icon = definition.Icon.Name
+		}
+		if definition.GenericIcon != nil {
+			entry.genericIcon = definition.GenericIcon.Name
+		}
+		entry.innerXML = append(entry.innerXML, definition.InnerXML)
+	}
+}
+
+func (db *mimeDatabase) write(dir string) error {
+	const header = "# This file was automatically generated by zap.\n# Do not edit!\n"
+
+	var mimeTypes []string
+	for mimeType := range db.types {
+		mimeTypes = append(mimeTypes, mimeType)
+	}
+	sort.Strings(mimeTypes)
+
+	sort.SliceStable(db.globs, func(i, j int) bool {
+		if db.globs[i].weight != db.globs[j].weight {
+			return db.globs[i].weight > db.globs[j].weight
+		}
+		if db.globs[i].mimeType != db.globs[j].mimeType {
+			return db.globs[i].mimeType < db.globs[j].mimeType
+		}
+		return db.globs[i].pattern < db.globs[j].pattern
+	})
+
+	var globs, globs2 strings.Builder
+	globs.WriteString(header)
+	globs2.WriteString(header)
+	for _, glob := range db.globs {
+		globs.WriteString(fmt.Sprintf("%s:%s\n", glob.mimeType, glob.pattern))
+		if glob.caseSensitive {
+			globs2.WriteString(fmt.Sprintf("%d:%s:%s:cs\n", glob.weight, glob.mimeType, glob.pattern))
+		} else {
+			globs2.WriteString(fmt.Sprintf("%d:%s:%s\n", glob.weight, glob.mimeType, glob.pattern))
+		}
+	}
+
+	var aliasNames []string
+	for alias := range db.aliases {
+		aliasNames = append(aliasNames, alias)
+	}
+	sort.Strings(aliasNames)
+	var aliases strings.Builder
+	for _, alias := range aliasNames {
+		aliases.WriteString(fmt.Sprintf("%s %s\n", alias, db.aliases[alias]))
+	}
+
+	var types, subclasses, icons, genericIcons strings.Builder
+	for _, mimeType := range mimeTypes {
+		entry := db.types[mimeType]
+		types.WriteString(fmt.Sprintf("%s\n", mimeType))
+		for _, parent := range entry.parents {
+			subclasses.WriteString(fmt.Sprintf("%s %s\n", mimeType, parent))
+		}
+		if entry.icon != "" {
+			icons.WriteString(fmt.Sprintf("%s:%s\n", mimeType, entry.icon))
+		}
+		if entry.genericIcon != "" {
+			genericIcons.WriteString(fmt.Sprintf("%s:%s\n", mimeType, entry.genericIcon))
+		}
+
+		// the descriptions of the MIME type are read from <media>/<subtype>.xml
+		definitionFile := path.Join(dir, fmt.Sprintf("%s.xml", mimeType))
+		err := os.MkdirAll(path.Dir(definitionFile), 0755)
+		if err != nil {
+			return err
+		}
+		definition := fmt.Sprintf("<?xml version=\"1.0\" encoding=\"utf-8\"?>\n"+
+			"<mime-type xmlns=\"%s\" type=\"%s\">%s</mime-type>\n",
+			sharedMimeInfoNamespace, mimeType, strings.Join(entry.innerXML, ""))
+		err = os.WriteFile(definitionFile, []byte(definition), 0644)
+		if err != nil {
+			return err
+		}
+	}
+
+	for name, content := range map[string]string{
+		"globs":         globs.String(),
+		"globs2":        globs2.String(),
+		"aliases":       aliases.String(),
+		"subclasses":    subclasses.String(),
+		"types":         types.String(),
+		"icons":         icons.String(),
+		"generic-icons": genericIcons.String(),
+	} {
+		err := writeFileAtomic(path.Join(dir, name), []byte(content), 0644)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
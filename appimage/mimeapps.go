@@ -0,0 +1,170 @@
+package appimage
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/adrg/xdg"
+	"github.com/srevinsaju/zap/config"
+	"github.com/srevinsaju/zap/tui"
+	"gopkg.in/ini.v1"
+)
+
+const (
+	mimeAppsDefaultApplications = "Default Applications"
+	mimeAppsAddedAssociations   = "Added Associations"
+)
+
+// mimeAppsListPath returns the mimeapps.list of the user, which
+// desktop environments read the default applications from
+func mimeAppsListPath() string {
+	return path.Join(xdg.ConfigHome, "mimeapps.list")
+}
+
+func loadMimeAppsList() (*ini.File, error) {
+	ini.PrettyFormat = false
+	mimeAppsList := mimeAppsListPath()
+	data, err := os.ReadFile(mimeAppsList)
+	if os.IsNotExist(err) {
+		return ini.Empty(ini.LoadOptions{IgnoreInlineComment: true}), nil
+	} else if err != nil {
+		return nil, err
+	}
+	return ini.LoadSources(ini.LoadOptions{IgnoreInlineComment: true}, data)
+}
+
+func saveMimeAppsList(mimeApps *ini.File) error {
+	mimeAppsList := mimeAppsListPath()
+	err := os.MkdirAll(filepath.Dir(mimeAppsList), 0755)
+	if err != nil {
+		return err
+	}
+	var b bytes.Buffer
+	_, err = mimeApps.WriteTo(&b)
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(mimeAppsList, b.Bytes(), 0644)
+}
+
+// splitDesktopFileIds splits a list of desktop file ids in mimeapps.list
+func splitDesktopFileIds(value string) []string {
+	var desktopFileIds []string
+	for _, id := range strings.Split(value, ";") {
+		id = strings.TrimSpace(id)
+		if id != "" {
+			desktopFileIds = append(desktopFileIds, id)
+		}
+	}
+	return desktopFileIds
+}
+
+// mimeTypeFromArgument returns the MIME type for an argument of zap default,
+// which is either a MIME type, or the scheme of URLs
+func mimeTypeFromArgument(arg string) string {
+	if strings.Contains(arg, "/") {
+		return arg
+	}
+	return fmt.Sprintf("x-scheme-handler/%s", strings.TrimSuffix(strings.ToLower(arg), ":"))
+}
+
+// SetDefault makes the app installed as executable the default application
+// for each of the MIME types or URL schemes in targets
+func SetDefault(executable string, targets []string, config config.Store) error {
+	app, err := loadIndex(executable, config)
+	if err != nil {
+		return err
+	}
+	if app.DesktopFile == "" {
+		return fmt.Errorf("%s is not integrated with the desktop", executable)
+	}
+	desktopFileId := filepath.Base(app.DesktopFile)
+
+	desktopFile, err := ini.LoadSources(ini.LoadOptions{IgnoreInlineComment: true}, app.DesktopFile)
+	if err != nil {
+		return err
+	}
+	supported := map[string]bool{}
+	for _, mimeType := range strings.Split(desktopFile.Section("Desktop Entry").Key("MimeType").String(), ";") {
+		supported[strings.TrimSpace(mimeType)] = true
+	}
+
+	mimeApps, err := loadMimeAppsList()
+	if err != nil {
+		return err
+	}
+	for _, target := range targets {
+		mimeType := mimeTypeFromArgument(target)
+		if !supported[mimeType] {
+			logger.Warnf("%s does not declare support for %s", executable, mimeType)
+		}
+
+		mimeApps.Section(mimeAppsDefaultApplications).Key(mimeType).SetValue(fmt.Sprintf("%s;", desktopFileId))
+
+		// the association is added as well, so that the default is also
+		// used by desktop environments which only consider the apps
+		// associated with a MIME type
+		added := mimeApps.Section(mimeAppsAddedAssociations).Key(mimeType)
+		desktopFileIds := []string{desktopFileId}
+		for _, id := range splitDesktopFileIds(added.String()) {
+			if id != desktopFileId {
+				desktopFileIds = append(desktopFileIds, id)
+			}
+		}
+		added.SetValue(fmt.Sprintf("%s;", strings.Join(desktopFileIds, ";")))
+
+		fmt.Printf("✨ %s is now the default application for %s\n", tui.Green(executable), tui.Yellow(mimeType))
+	}
+	return saveMimeAppsList(mimeApps)
+}
+
+// removeDefaults removes desktopFileId from the default applications,
+// and the added associations of mimeapps.list
+func removeDefaults(desktopFileId string) error {
+	mimeAppsList := mimeAppsListPath()
+	if _, err := os.Stat(mimeAppsList); os.IsNotExist(err) {
+		return nil
+	}
+
+	mimeApps, err := loadMimeAppsList()
+	if err != nil {
+		return err
+	}
+
+	changed := false
+	for _, sectionName := range []string{mimeAppsDefaultApplications, mimeAppsAddedAssociations} {
+		section, err := mimeApps.GetSection(sectionName)
+		if err != nil {
+			continue
+		}
+		for _, key := range section.Keys() {
+			var desktopFileIds []string
+			for _, id := range splitDesktopFileIds(key.String()) {
+				if id != desktopFileId {
+					desktopFileIds = append(desktopFileIds, id)
+				}
+			}
+			if len(desktopFileIds) == len(splitDesktopFileIds(key.String())) {
+				continue
+			}
+			changed = true
+			if len(desktopFileIds) == 0 {
+				section.DeleteKey(key.Name())
+			} else {
+				key.SetValue(fmt.Sprintf("%s;", strings.Join(desktopFileIds, ";")))
+			}
+		}
+		if len(section.Keys()) == 0 {
+			mimeApps.DeleteSection(sectionName)
+		}
+	}
+	if !changed {
+		return nil
+	}
+	logger.Debugf("Removing %s from %s", desktopFileId, mimeAppsList)
+	return saveMimeAppsList(mimeApps)
+}
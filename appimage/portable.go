@@ -0,0 +1,105 @@
+package appimage
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/AlecAivazis/survey/v2"
+	"github.com/srevinsaju/zap/config"
+	"github.com/srevinsaju/zap/internal/helpers"
+	"github.com/srevinsaju/zap/tui"
+)
+
+// portableDirs returns the portable home and config directories of the
+// appimage at appImagePath, which the AppImage runtime uses as $HOME and
+// $XDG_CONFIG_HOME, if they exist
+func portableDirs(appImagePath string) []string {
+	return []string{
+		fmt.Sprintf("%s.home", appImagePath),
+		fmt.Sprintf("%s.config", appImagePath),
+	}
+}
+
+// migratePortableDirs renames the portable directories of the appimage
+// previously installed at previousFilepath, to follow the new appimage
+func (appimage AppImage) migratePortableDirs(previousFilepath string) {
+	if previousFilepath == appimage.Filepath {
+		return
+	}
+	previousDirs := portableDirs(previousFilepath)
+	for i, dir := range portableDirs(appimage.Filepath) {
+		if !helpers.CheckIfDirectoryExists(previousDirs[i]) {
+			continue
+		}
+		logger.Debugf("Moving %s to %s", previousDirs[i], dir)
+		err := os.Rename(previousDirs[i], dir)
+		if err != nil {
+			logger.Warnf("Failed to move %s to %s, %s", previousDirs[i], dir, err)
+		}
+	}
+}
+
+// removePortableDirs removes the portable directories of the appimage,
+// after asking the user, as they contain the data of the app
+func (appimage AppImage) removePortableDirs() {
+	var dirs []string
+	for _, dir := range portableDirs(appimage.Filepath) {
+		if helpers.CheckIfDirectoryExists(dir) {
+			dirs = append(dirs, dir)
+		}
+	}
+	if len(dirs) == 0 {
+		return
+	}
+
+	removeDirs := false
+	err := survey.AskOne(&survey.Confirm{
+		Message: fmt.Sprintf("Remove the portable home and config directories of %s?", appimage.Executable),
+		Help:    "These directories contain the data and settings of the app",
+	}, &removeDirs)
+	if err != nil || !removeDirs {
+		for _, dir := range dirs {
+			fmt.Printf("Keeping %s\n", tui.Yellow(dir))
+		}
+		return
+	}
+	for _, dir := range dirs {
+		logger.Debugf("Removing %s", dir)
+		err = os.RemoveAll(dir)
+		if err != nil {
+			logger.Warnf("Failed to remove %s, %s", dir, err)
+		}
+	}
+}
+
+// EnablePortable creates the portable home and config directories of an
+// installed app, so that its data is kept separately from $HOME
+func EnablePortable(executable string, config config.Store) error {
+	app, err := loadIndex(executable, config)
+	if err != nil {
+		return err
+	}
+
+	for _, dir := range portableDirs(app.Filepath) {
+		logger.Debugf("Creating %s", dir)
+		err = os.MkdirAll(dir, 0700)
+		if err != nil {
+			return err
+		}
+	}
+	app.Portable = true
+
+	// extracted appimages are launched without the
+	// AppImage runtime, so the launcher sets them
+	err = app.refreshLauncher(config)
+	if err != nil {
+		logger.Warnf("Failed to update the launcher of %s, %s", executable, err)
+	}
+
+	err = saveIndex(app, config)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("✨ %s now keeps its data in %s\n", tui.Green(executable), tui.Yellow(portableDirs(app.Filepath)[0]))
+	return nil
+}
@@ -0,0 +1,126 @@
+package appimage
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"syscall"
+	"time"
+
+	"github.com/srevinsaju/zap/config"
+)
+
+// lastRun returns when the appimage was last launched through zap run. For
+// appimages which were never launched, it is the time the appimage was
+// installed or updated
+func (appimage AppImage) lastRun() time.Time {
+	if appimage.LastRun != "" {
+		lastRun, err := time.Parse(time.RFC3339, appimage.LastRun)
+		if err == nil {
+			return lastRun
+		}
+	}
+	info, err := os.Stat(appimage.Filepath)
+	if err != nil {
+		return time.Time{}
+	}
+	return info.ModTime()
+}
+
+// recordLaunch loads the index of executable, and records a launch in it.
+// The index is read and written under its lock, as apps are often launched
+// concurrently. Failing to record the launch is not an error
+func recordLaunch(executable string, config config.Store) (*AppImage, error) {
+	unlock, err := lockIndex(config)
+	if err != nil {
+		logger.Warnf("Failed to record the launch of %s, %s", executable, err)
+		return loadIndex(executable, config)
+	}
+	defer unlock()
+
+	app, err := loadIndex(executable, config)
+	if err != nil {
+		return nil, err
+	}
+	app.LastRun = time.Now().Format(time.RFC3339)
+	app.LaunchCount++
+	err = writeIndex(app, config)
+	if err != nil {
+		// the app is launched regardless
+		logger.Warnf("Failed to record the launch of %s, %s", executable, err)
+	}
+	return app, nil
+}
+
+// Run launches an installed app with its launch configuration, and records
+// the launch in the index. It only returns if the app could not be launched
+func Run(executable string, args []string, config config.Store) error {
+	app, err := recordLaunch(executable, config)
+	if err != nil {
+		return err
+	}
+
+	env := append(os.Environ(), app.launchEnv()...)
+	if app.Extracted != "" {
+		// like the AppImage runtime, before changing the directory
+		owd, err := os.Getwd()
+		if err != nil {
+			return err
+		}
+		env = append(env, fmt.Sprintf("ARGV0=%s", app.Executable), fmt.Sprintf("OWD=%s", owd))
+	}
+
+	if app.Launch.WorkingDir != "" {
+		err = os.Chdir(app.Launch.WorkingDir)
+		if err != nil {
+			return err
+		}
+	}
+
+	argv, err := app.launchCommand()
+	if err != nil {
+		return err
+	}
+	argv = append(argv, args...)
+
+	logger.Debugf("Launching %s", argv)
+	return syscall.Exec(argv[0], argv, env)
+}
+
+// ListUnused returns the installed apps, which were not launched
+// through zap run within unusedFor, the least recently used first
+func ListUnused(config config.Store, unusedFor time.Duration) ([]AppImage, error) {
+	apps, err := List(config, false)
+	if err != nil {
+		return nil, err
+	}
+	if !config.TrackUsage {
+		logger.Warnf("TrackUsage is off, so the apps launched from ~/.local/bin or the menu are listed as unused. " +
+			"Set TrackUsage = true in the configuration, and run zap integrate --all")
+	}
+
+	cutoff := time.Now().Add(-unusedFor)
+	var unused []AppImage
+	for _, executable := range apps {
+		app, err := loadIndex(executable, config)
+		if err != nil {
+			logger.Warnf("Failed to read the index of %s, %s", executable, err)
+			continue
+		}
+		if app.lastRun().Before(cutoff) {
+			unused = append(unused, *app)
+		}
+	}
+	sort.Slice(unused, func(i, j int) bool {
+		return unused[i].lastRun().Before(unused[j].lastRun())
+	})
+	return unused, nil
+}
+
+// UsageSummary describes when the appimage was last launched through zap run
+func (appimage AppImage) UsageSummary() string {
+	if appimage.LaunchCount == 0 {
+		return fmt.Sprintf("never run, installed %s", appimage.lastRun().Format("2006-01-02"))
+	}
+	return fmt.Sprintf("last run %s, %d launches", appimage.lastRun().Format("2006-01-02"), appimage.LaunchCount)
+}
@@ -0,0 +1,65 @@
+package appimage
+
+import (
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/srevinsaju/zap/config"
+)
+
+func TestRecordLaunchConcurrently(t *testing.T) {
+	dir := t.TempDir()
+	cfg := config.Store{
+		LocalStore: dir,
+		IndexStore: filepath.Join(dir, "index"),
+	}
+	if err := os.MkdirAll(cfg.IndexStore, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := saveIndex(&AppImage{Executable: "foo"}, cfg); err != nil {
+		t.Fatal(err)
+	}
+
+	const launches = 20
+	var wg sync.WaitGroup
+	for i := 0; i < launches; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := recordLaunch("foo", cfg); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	app, err := loadIndex("foo", cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if app.LaunchCount != launches {
+		t.Errorf("LaunchCount = %d, want %d", app.LaunchCount, launches)
+	}
+	if app.LastRun == "" {
+		t.Error("LastRun was not recorded")
+	}
+
+	// the index store only has the index of foo
+	files, err := os.ReadDir(cfg.IndexStore)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 1 || files[0].Name() != "foo.json" {
+		t.Errorf("files in the index store = %v, want only foo.json", files)
+	}
+}
+
+func TestRecordLaunchNotInstalled(t *testing.T) {
+	dir := t.TempDir()
+	cfg := config.Store{LocalStore: dir, IndexStore: dir}
+	if _, err := recordLaunch("foo", cfg); err == nil {
+		t.Error("recording the launch of an app which is not installed did not fail")
+	}
+}
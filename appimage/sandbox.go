@@ -0,0 +1,293 @@
+package appimage
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/adrg/xdg"
+	"github.com/srevinsaju/zap/config"
+	"github.com/srevinsaju/zap/tui"
+)
+
+const (
+	SandboxNone    = "none"
+	SandboxDefault = "default"
+	SandboxStrict  = "strict"
+)
+
+// sandboxProfile describes what a sandboxed appimage has access to
+type sandboxProfile struct {
+	// network allows access to the network
+	network bool
+
+	// homeDirs are the directories in the home directory, which the
+	// appimage can read and write. The rest of the home directory
+	// is hidden
+	homeDirs []string
+
+	// persistentHome uses the portable home and config directories of
+	// the appimage as its home, creating them if needed, so that its
+	// settings and data are kept. Otherwise the appimage starts with an
+	// empty home directory every time
+	persistentHome bool
+
+	// gpu allows access to /dev/dri, for hardware acceleration
+	gpu bool
+
+	// x11 allows access to the X server, which lets the appimage read
+	// the input to, and inject input into other windows
+	x11 bool
+}
+
+// sandboxProfiles are the built-in sandbox profiles. Apart from the
+// sockets of Wayland, PulseAudio and PipeWire, the XDG runtime directory
+// is hidden, as it has the D-Bus session bus and the agents of ssh and
+// gpg, through which processes can be started outside the sandbox
+var sandboxProfiles = map[string]sandboxProfile{
+	SandboxDefault: {
+		network:        true,
+		homeDirs:       []string{"Downloads"},
+		persistentHome: true,
+		gpu:            true,
+		x11:            true,
+	},
+	SandboxStrict: {},
+}
+
+// sandboxSystemDirs are the directories the system is installed into, which
+// are visible in the sandbox, read only. The rest of the file system, like
+// /home, /media and /mnt, is hidden
+var sandboxSystemDirs = []string{"/usr", "/etc", "/opt", "/bin", "/sbin", "/lib", "/lib32", "/lib64", "/libx32"}
+
+// sandboxSockets returns the sockets of the display server and the sound
+// server in the XDG runtime directory, which are visible in the sandbox
+func sandboxSockets() []string {
+	var sockets []string
+	if display := os.Getenv("WAYLAND_DISPLAY"); display != "" {
+		if !path.IsAbs(display) {
+			display = path.Join(xdg.RuntimeDir, display)
+		}
+		sockets = append(sockets, display)
+	}
+	sockets = append(sockets, path.Join(xdg.RuntimeDir, "pulse", "native"))
+	pipewire := os.Getenv("PIPEWIRE_REMOTE")
+	if pipewire == "" {
+		pipewire = "pipewire-0"
+	}
+	if !path.IsAbs(pipewire) {
+		pipewire = path.Join(xdg.RuntimeDir, pipewire)
+	}
+	return append(sockets, pipewire)
+}
+
+// sandboxProfileNames returns the names of the profiles, which can
+// be used with zap sandbox set
+func sandboxProfileNames() []string {
+	names := []string{SandboxNone}
+	for name := range sandboxProfiles {
+		names = append(names, name)
+	}
+	sort.Strings(names[1:])
+	return names
+}
+
+// sandboxCommand returns the command which runs the appimage in the
+// sandbox of profile, with bwrap, or firejail if bwrap is not installed
+func (appimage AppImage) sandboxCommand(profileName string) ([]string, error) {
+	profile, ok := sandboxProfiles[profileName]
+	if !ok {
+		return nil, fmt.Errorf("unknown sandbox profile %s, expected one of %s",
+			profileName, strings.Join(sandboxProfileNames(), ", "))
+	}
+	if profile.persistentHome {
+		for _, dir := range portableDirs(appimage.Filepath) {
+			err := os.MkdirAll(dir, 0700)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+	if bwrap, err := exec.LookPath("bwrap"); err == nil {
+		return append([]string{bwrap}, profile.bwrapArgs(appimage)...), nil
+	}
+	if firejail, err := exec.LookPath("firejail"); err == nil {
+		return append([]string{firejail}, profile.firejailArgs(appimage)...), nil
+	}
+	return nil, errors.New("sandboxing needs bwrap (bubblewrap) or firejail to be installed")
+}
+
+// bwrapArgs returns the arguments to bwrap, to run the appimage
+// with the profile
+func (profile sandboxProfile) bwrapArgs(appimage AppImage) []string {
+	appImagePath := appimage.Filepath
+	var args []string
+	for _, dir := range sandboxSystemDirs {
+		info, err := os.Lstat(dir)
+		if err != nil {
+			continue
+		}
+		// on merged /usr systems, /bin and /lib link into /usr
+		if target, err := os.Readlink(dir); err == nil && info.Mode()&os.ModeSymlink != 0 {
+			args = append(args, "--symlink", target, dir)
+		} else {
+			args = append(args, "--ro-bind", dir, dir)
+		}
+	}
+	args = append(args,
+		"--dev", "/dev",
+		"--proc", "/proc",
+		"--tmpfs", "/tmp",
+		"--tmpfs", xdg.Home,
+		"--tmpfs", xdg.RuntimeDir,
+		"--ro-bind", appImagePath, appImagePath,
+	)
+	if appimage.Extracted != "" {
+		args = append(args, "--ro-bind", appimage.Extracted, appimage.Extracted)
+	}
+	for _, dir := range portableDirs(appImagePath) {
+		args = append(args, "--bind-try", dir, dir)
+	}
+	for _, dir := range profile.homeDirs {
+		dir = path.Join(xdg.Home, dir)
+		args = append(args, "--bind-try", dir, dir)
+	}
+	if profile.persistentHome {
+		// like the AppImage runtime does, when they exist
+		dirs := portableDirs(appImagePath)
+		args = append(args, "--setenv", "HOME", dirs[0], "--setenv", "XDG_CONFIG_HOME", dirs[1])
+	}
+	for _, socket := range sandboxSockets() {
+		args = append(args, "--bind-try", socket, socket)
+	}
+	if profile.x11 {
+		xauthority := os.Getenv("XAUTHORITY")
+		if xauthority == "" {
+			xauthority = path.Join(xdg.Home, ".Xauthority")
+		}
+		args = append(args,
+			"--bind-try", "/tmp/.X11-unix", "/tmp/.X11-unix",
+			"--ro-bind-try", xauthority, xauthority,
+		)
+	} else {
+		// prevents the appimage from injecting input into the terminal
+		args = append(args, "--new-session", "--unsetenv", "DISPLAY")
+	}
+	if profile.gpu {
+		args = append(args, "--dev-bind-try", "/dev/dri", "/dev/dri")
+		// Mesa finds the GPU through sysfs
+		for _, dir := range []string{"/sys/dev", "/sys/devices", "/sys/bus", "/sys/class"} {
+			args = append(args, "--ro-bind-try", dir, dir)
+		}
+	}
+	args = append(args, "--unshare-all")
+	if profile.network {
+		// /etc/resolv.conf links into /run on systemd-resolved systems
+		args = append(args,
+			"--share-net",
+			"--ro-bind-try", "/run/systemd/resolve", "/run/systemd/resolve",
+		)
+	}
+	// FUSE is not available in the sandbox
+	args = append(args,
+		"--die-with-parent",
+		"--unsetenv", "DBUS_SESSION_BUS_ADDRESS",
+		"--unsetenv", "SSH_AUTH_SOCK",
+		"--setenv", "APPIMAGE_EXTRACT_AND_RUN", "1",
+		"--",
+	)
+	return args
+}
+
+// firejailArgs returns the arguments to firejail, to run the appimage
+// with the profile
+func (profile sandboxProfile) firejailArgs(appimage AppImage) []string {
+	args := []string{
+		"--quiet",
+		"--noprofile",
+		"--caps.drop=all",
+		"--nonewprivs",
+		"--noroot",
+		// like the XDG runtime directory with bwrap
+		"--dbus-user=none",
+		"--dbus-system=none",
+		"--blacklist=/media",
+		"--blacklist=/mnt",
+		"--blacklist=/run/media",
+		fmt.Sprintf("--blacklist=%s", path.Join(xdg.RuntimeDir, "gnupg")),
+		fmt.Sprintf("--blacklist=%s", path.Join(xdg.RuntimeDir, "keyring")),
+		fmt.Sprintf("--blacklist=%s", path.Join(xdg.RuntimeDir, "systemd")),
+		"--rmenv=SSH_AUTH_SOCK",
+	}
+	if appimage.Extracted != "" {
+		// whitelisting hides the rest of the home directory
+		args = append(args,
+			fmt.Sprintf("--whitelist=%s", appimage.Extracted),
+			fmt.Sprintf("--read-only=%s", appimage.Extracted),
+		)
+	} else if len(profile.homeDirs) == 0 && !profile.persistentHome {
+		args = append(args, "--private")
+	}
+	for _, dir := range profile.homeDirs {
+		args = append(args, fmt.Sprintf("--whitelist=%s", path.Join(xdg.Home, dir)))
+	}
+	if profile.persistentHome {
+		dirs := portableDirs(appimage.Filepath)
+		args = append(args,
+			fmt.Sprintf("--whitelist=%s", dirs[0]),
+			fmt.Sprintf("--whitelist=%s", dirs[1]),
+			fmt.Sprintf("--env=HOME=%s", dirs[0]),
+			fmt.Sprintf("--env=XDG_CONFIG_HOME=%s", dirs[1]),
+		)
+	}
+	if !profile.x11 {
+		args = append(args, "--x11=none")
+	}
+	if !profile.gpu {
+		args = append(args, "--no3d")
+	}
+	if !profile.network {
+		args = append(args, "--net=none")
+	}
+	if appimage.Extracted == "" {
+		// firejail mounts the appimage itself
+		args = append(args, "--appimage")
+	}
+	return args
+}
+
+// SetSandbox changes the sandbox profile an installed app is launched with,
+// and recreates its launcher
+func SetSandbox(executable string, profileName string, config config.Store) error {
+	app, err := loadIndex(executable, config)
+	if err != nil {
+		return err
+	}
+
+	if profileName == SandboxNone {
+		app.Sandbox = ""
+	} else {
+		// check that the profile exists, and that a sandbox is installed
+		_, err = app.sandboxCommand(profileName)
+		if err != nil {
+			return err
+		}
+		app.Sandbox = profileName
+	}
+
+	err = app.refreshLauncher(config)
+	if err != nil {
+		return err
+	}
+
+	err = saveIndex(app, config)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("✨ %s is launched with the %s sandbox profile\n", tui.Green(executable), tui.Yellow(profileName))
+	return nil
+}
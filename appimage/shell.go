@@ -0,0 +1,148 @@
+package appimage
+
+import (
+	"os"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/adrg/xdg"
+	"github.com/srevinsaju/zap/config"
+)
+
+// shellFiles describes a kind of file for the command line, which
+// AppImages ship, and where it is installed for the user
+type shellFiles struct {
+	// patterns are the locations within the AppImage
+	patterns []string
+
+	// target is the directory the files are installed into
+	target string
+
+	// keepTree keeps the directories below the pattern,
+	// like the sections of man pages
+	keepTree bool
+}
+
+func completionFiles(cfg config.Store) []shellFiles {
+	var files []shellFiles
+	if cfg.InstallBashCompletions {
+		files = append(files, shellFiles{
+			patterns: []string{"usr/share/bash-completion/completions/*"},
+			target:   path.Join(xdg.DataHome, "bash-completion", "completions"),
+		})
+	}
+	if cfg.InstallZshCompletions {
+		// ~/.local/share/zsh/site-functions has to be added to $fpath
+		files = append(files, shellFiles{
+			patterns: []string{"usr/share/zsh/site-functions/*", "usr/share/zsh/vendor-completions/*"},
+			target:   path.Join(xdg.DataHome, "zsh", "site-functions"),
+		})
+	}
+	if cfg.InstallFishCompletions {
+		files = append(files, shellFiles{
+			patterns: []string{"usr/share/fish/vendor_completions.d/*", "usr/share/fish/completions/*"},
+			target:   path.Join(xdg.DataHome, "fish", "vendor_completions.d"),
+		})
+	}
+	return files
+}
+
+func manPageFiles(cfg config.Store) []shellFiles {
+	if !cfg.InstallManPages {
+		return nil
+	}
+	// man finds ~/.local/share/man, because ~/.local/bin is on $PATH
+	return []shellFiles{{
+		patterns: []string{"usr/share/man/*"},
+		target:   path.Join(xdg.DataHome, "man"),
+		keepTree: true,
+	}}
+}
+
+// installShellFiles installs the shell completions and man pages of the
+// AppImage, which are enabled in the configuration. They are installed
+// whether or not the AppImage is integrated with the desktop
+func (appimage *AppImage) installShellFiles(cfg config.Store) {
+	dir, err := os.MkdirTemp("", "zap")
+	if err != nil {
+		logger.Debug("Creating temporary directory for shell file extraction failed")
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	for _, files := range completionFiles(cfg) {
+		appimage.Completions = append(appimage.Completions, appimage.installFiles(dir, files)...)
+	}
+	for _, files := range manPageFiles(cfg) {
+		appimage.ManPages = append(appimage.ManPages, appimage.installFiles(dir, files)...)
+	}
+}
+
+// installFiles extracts the files of a kind into its target directory, and
+// returns the files which were installed. Files which were not installed by
+// this app are not replaced
+func (appimage *AppImage) installFiles(dir string, files shellFiles) []string {
+	var installed []string
+	for _, pattern := range files.patterns {
+		extracted := appimage.ExtractAll(dir, pattern)
+		var relPaths []string
+		for rel := range extracted {
+			relPaths = append(relPaths, rel)
+		}
+		sort.Strings(relPaths)
+
+		base := path.Dir(pattern)
+		for _, rel := range relPaths {
+			name := path.Base(rel)
+			if files.keepTree {
+				name = strings.TrimPrefix(rel, base+"/")
+			}
+			target := path.Join(files.target, name)
+
+			if _, err := os.Stat(target); err == nil && !appimage.ownsShellFile(target) {
+				logger.Debugf("Not replacing %s, which belongs to another app", target)
+				continue
+			}
+
+			err := os.MkdirAll(path.Dir(target), 0755)
+			if err != nil {
+				logger.Warnf("Failed to create %s, %s", path.Dir(target), err)
+				continue
+			}
+			data, err := os.ReadFile(extracted[rel])
+			if err != nil {
+				logger.Warnf("Failed to read %s, %s", rel, err)
+				continue
+			}
+			logger.Debugf("Installing %s to %s", rel, target)
+			err = writeFileAtomic(target, data, 0644)
+			if err != nil {
+				logger.Warnf("Failed to install %s, %s", target, err)
+				continue
+			}
+			installed = append(installed, target)
+		}
+	}
+	return installed
+}
+
+func (appimage AppImage) ownsShellFile(file string) bool {
+	for _, f := range append(appimage.Completions, appimage.ManPages...) {
+		if f == file {
+			return true
+		}
+	}
+	return false
+}
+
+// uninstallShellFiles removes the shell completions and man pages
+// installed by installShellFiles
+func (appimage *AppImage) uninstallShellFiles() {
+	for _, f := range append(appimage.Completions, appimage.ManPages...) {
+		logger.Debugf("Removing %s", f)
+		_ = os.Remove(f)
+	}
+	appimage.Completions = nil
+	appimage.ManPages = nil
+}
@@ -2,8 +2,6 @@ package appimage
 
 import (
 	"fmt"
-	"image"
-	_ "image/png"
 	"os"
 	"os/exec"
 	"path"
@@ -13,9 +11,10 @@ import (
 	"github.com/gabriel-vasile/mimetype"
 
 	"github.com/AlecAivazis/survey/v2"
-	"github.com/adrg/xdg"
 	"github.com/srevinsaju/zap/config"
 	"github.com/srevinsaju/zap/internal/helpers"
+	"github.com/srevinsaju/zap/tui"
+	"github.com/srevinsaju/zap/types"
 	"gopkg.in/ini.v1"
 )
 
@@ -23,12 +22,21 @@ const (
 	SourceGitHub    = "git.github"
 	SourceDirectURL = "raw.url"
 	SourceZapIndex  = "idx.zap"
+
+	// SourceUpdateInformation is the update information
+	// embedded in the appimage, in Meta.URL
+	SourceUpdateInformation = "upd.info"
 )
 
 type SourceMetadata struct {
 	Slug      string `json:"slug,omitempty"`
 	URL       string `json:"url,omitempty"`
 	CrawledOn string `json:"crawled_on,omitempty"`
+
+	// Tag and Upstream are the release the app was installed
+	// from, and its source, as recorded in the zap index
+	Tag      string           `json:"tag,omitempty"`
+	Upstream *types.ZapSource `json:"upstream,omitempty"`
 }
 
 type Source struct {
@@ -43,6 +51,51 @@ type AppImage struct {
 	IconPathHicolor string `json:"icon_path_hicolor,omitempty"`
 	DesktopFile     string `json:"desktop_file,omitempty"`
 	Source          Source `json:"source"`
+
+	// Icons are the icons installed into the hicolor icon theme
+	Icons []string `json:"icons,omitempty"`
+
+	// MimePackages are the shared-mime-info packages installed
+	// into the MIME database of the user
+	MimePackages []string `json:"mime_packages,omitempty"`
+
+	// Completions and ManPages are the shell completions
+	// and man pages installed for the user
+	Completions []string `json:"completions,omitempty"`
+	ManPages    []string `json:"man_pages,omitempty"`
+
+	// Integration records if the user has integrated or unintegrated
+	// the appimage, so that it is kept across updates
+	Integration string `json:"integration,omitempty"`
+
+	// Autostart starts the appimage when the user logs in
+	Autostart bool `json:"autostart,omitempty"`
+
+	// Launch configures the launcher in ~/.local/bin, which
+	// the desktop file launches the appimage through as well
+	Launch LaunchConfig `json:"launch,omitempty"`
+
+	// LastRun and LaunchCount record the launches through zap run
+	LastRun     string `json:"last_run,omitempty"`
+	LaunchCount int    `json:"launch_count,omitempty"`
+
+	// Sandbox is the sandbox profile the appimage is launched with
+	Sandbox string `json:"sandbox,omitempty"`
+
+	// Portable keeps the data of the appimage in the portable
+	// home and config directories next to it
+	Portable bool `json:"portable,omitempty"`
+
+	// Extracted is the directory the appimage is extracted into,
+	// if it is launched without FUSE
+	Extracted string `json:"extracted,omitempty"`
+
+	// Sha256 is the checksum of the appimage when it was installed
+	Sha256 string `json:"sha256,omitempty"`
+
+	// Broken are the problems with the installation,
+	// which zap repair could not fix
+	Broken []string `json:"broken,omitempty"`
 }
 
 func (appimage AppImage) getBaseName() string {
@@ -79,23 +132,9 @@ func (appimage *AppImage) ExtractThumbnail(target string) {
 	} else if err != nil && os.Getenv("ZAP_IGNORE_MIMETYPE_CONFLICTS") == "1" {
 		logger.Warn("Failed retrieving mimetype from the .Diricon image, ignoring this error because ZAP_IGNORE_MIMETYPE_CONFLICTS is set as 1, on environment variables")
 	} else {
-		ext = mtype.Extension()
+		ext = strings.TrimPrefix(mtype.Extension(), ".")
 	}
 
-	buf.Seek(0, 0)
-	var im image.Config
-	if ext == "png" {
-		logger.Debugf("Trying to read image dimensions from %s", dirIcon)
-		if err != nil {
-			logger.Fatal(err)
-		}
-		logger.Debug("Decoding PNG image")
-		im, _, err = image.DecodeConfig(buf)
-		if err != nil {
-			logger.Warn(err)
-			return
-		}
-	}
 	err = buf.Close()
 	if err != nil {
 		logger.Warn("failed to close the icon file", err)
@@ -111,43 +150,9 @@ func (appimage *AppImage) ExtractThumbnail(target string) {
 		return
 	}
 
-	logger.Debugf("Calculating symlink location")
-	var xdgIconPath string
-	if ext == "png" {
-		xdgIconPath, err = xdg.DataFile(fmt.Sprintf("icons/hicolor/%dx%d/apps/", im.Width, im.Width))
-	} else {
-		xdgIconPath, err = xdg.DataFile("icons/hicolor/scalable/apps/")
-	}
-	if err != nil {
-		logger.Warn(err)
-		return
-	}
-
-	targetXdgIconPath := filepath.Join(xdgIconPath, baseIconName)
-	logger.Debugf("Attempting to create directory to %s", targetXdgIconPath)
-	err = os.MkdirAll(filepath.Dir(targetXdgIconPath), 0777)
-	if err != nil {
-		logger.Warn("Couldn't create target directory", filepath.Dir(targetXdgIconPath), err)
-		logger.Warn("Not copying the icon.")
-		return
-	}
-
-	logger.Debugf("Attempting to create symlink to %s", targetXdgIconPath)
-	if helpers.CheckIfSymlinkExists(targetXdgIconPath) {
-		logger.Debugf("%s is an existing symlink. Attempting to remove it", targetXdgIconPath)
-		err := os.Remove(targetXdgIconPath)
-		if err != nil {
-			logger.Debug("Failed to remove the existing thumbnail, ignoring.", err)
-		}
-	}
-	err = os.Symlink(targetIconPath, targetXdgIconPath)
-	if err != nil {
-		logger.Warn(err)
-		return
-	}
-
+	// the icon is installed into the hicolor icon theme,
+	// when the appimage is integrated
 	appimage.IconPath = targetIconPath
-	appimage.IconPathHicolor = targetXdgIconPath
 	logger.Debugf("Copied .DirIcon -> %s", targetIconPath)
 
 }
@@ -173,7 +178,8 @@ func (appimage AppImage) Extract(dir string, relPath string) string {
 		panic(err)
 	}
 	if len(paths) == 0 {
-		logger.Fatal("Could not find any file matching pattern", relPath)
+		logger.Debugf("Could not find any file matching pattern %s", relPath)
+		return ""
 	}
 	dirIcon = paths[0]
 
@@ -201,6 +207,93 @@ func (appimage AppImage) Extract(dir string, relPath string) string {
 
 }
 
+// ExtractAll extracts every file matching relPath into dir, including the
+// files within matching directories. It returns a map of the path of each
+// file within the AppImage to the extracted file. Symlinks are resolved
+// to the file they point to within the AppImage
+func (appimage AppImage) ExtractAll(dir string, relPath string) map[string]string {
+	files := map[string]string{}
+
+	logger.Debugf("Trying to extract %s", relPath)
+	cmd := exec.Command(appimage.Filepath, "--appimage-extract", relPath)
+	cmd.Dir = dir
+	err := cmd.Run()
+	if err != nil {
+		logger.Debugf("%s --appimage-extract %s failed with %s.", appimage.Filepath, relPath, err)
+		return files
+	}
+
+	root := path.Join(dir, "squashfs-root")
+	paths, err := filepath.Glob(path.Join(root, relPath))
+	if err != nil {
+		logger.Debugf("Invalid pattern %s, %s", relPath, err)
+		return files
+	}
+
+	for _, match := range paths {
+		_ = filepath.Walk(match, func(file string, info os.FileInfo, err error) error {
+			if err != nil || info.IsDir() {
+				return nil
+			}
+			rel, err := filepath.Rel(root, file)
+			if err != nil {
+				return nil
+			}
+			if info.Mode()&os.ModeSymlink != 0 {
+				file = appimage.extractSymlinkTarget(dir, rel, 0)
+				if file == "" {
+					return nil
+				}
+			}
+			files[rel] = file
+			return nil
+		})
+	}
+	return files
+}
+
+// extractSymlinkTarget extracts the file which the symlink at rel within
+// the AppImage points to, and returns the path of the extracted file
+func (appimage AppImage) extractSymlinkTarget(dir string, rel string, hops int) string {
+	root := path.Join(dir, "squashfs-root")
+	if hops > 8 {
+		logger.Debugf("Too many levels of symlinks at %s", rel)
+		return ""
+	}
+
+	link, err := os.Readlink(path.Join(root, rel))
+	if err != nil {
+		return ""
+	}
+	// absolute symlinks are relative to the root of the AppImage
+	target := strings.TrimPrefix(link, "/")
+	if !path.IsAbs(link) {
+		target = path.Join(path.Dir(rel), link)
+	}
+	target = path.Clean(target)
+	if target == ".." || strings.HasPrefix(target, "../") {
+		logger.Debugf("%s points outside of the AppImage", rel)
+		return ""
+	}
+
+	cmd := exec.Command(appimage.Filepath, "--appimage-extract", target)
+	cmd.Dir = dir
+	err = cmd.Run()
+	if err != nil {
+		return ""
+	}
+	info, err := os.Lstat(path.Join(root, target))
+	if err != nil {
+		return ""
+	}
+	if info.Mode()&os.ModeSymlink != 0 {
+		return appimage.extractSymlinkTarget(dir, target, hops+1)
+	} else if info.IsDir() {
+		return ""
+	}
+	return path.Join(root, target)
+}
+
 // ExtractDesktopFile helps to extract the thumbnails to config.icons directory
 // with the apps' basename and png as the Name */
 func (appimage AppImage) ExtractDesktopFile() ([]byte, error) {
@@ -223,99 +316,77 @@ func (appimage AppImage) ExtractDesktopFile() ([]byte, error) {
 	return data, nil
 }
 
-// ProcessDesktopFile extracts the desktop file, adds appimage
-// specific keys, and updates them.
-func (appimage *AppImage) ProcessDesktopFile(cfg config.Store) {
-	// check if dependencies are present
-	if !commandExists("xdg-desktop-menu") {
-		logger.Fatal("Could not find 'xdg-desktop-menu' on your system. " +
-			"Please refer to https://command-not-found.com/xdg-desktop-menu " +
-			"for more information.")
-	}
-
+// loadDesktopFile extracts the desktop file of the appimage, and parses it
+func (appimage AppImage) loadDesktopFile() (*ini.File, error) {
 	ini.PrettyFormat = false
 
 	data, err := appimage.ExtractDesktopFile()
 	if err != nil {
-		return
+		return nil, err
 	}
 
 	logger.Debug("Parsing INI v1 desktop file")
 	desktopFile, err := ini.LoadSources(ini.LoadOptions{IgnoreInlineComment: true}, data)
 	if err != nil {
 		logger.Debug("failed to parse desktop file with ini")
-		return
+		return nil, err
 	}
 	logger.Debug("Parse INI v1 desktop file completed with no errors ")
+	return desktopFile, nil
+}
 
-	desktopEntry := desktopFile.Section("Desktop Entry")
-
-	// the appimage has explicitly requested not to be integrated
-	if desktopEntry.Key("X-AppImage-Integrate").String() == "true" {
+// ProcessDesktopFile extracts the desktop file, and integrates the
+// appimage, if it should be integrated.
+func (appimage *AppImage) ProcessDesktopFile(cfg config.Store) {
+	desktopFile, err := appimage.loadDesktopFile()
+	if err != nil {
 		return
 	}
 
-	if cfg.Integrate == config.IntegrateNever {
-		// user has configured not to integrate
-		// newly installed appimages
+	if appimage.Integration == IntegrationDisabled {
+		// the user has unintegrated the appimage,
+		// this is kept across updates
 		return
 	}
 
-	if cfg.Integrate == config.IntegrateAsk {
-		integrateEnabled := false
-		integrateEnabledPrompt := &survey.Confirm{
-			Message: "Do you want to integrate this appimage?",
-			Help:    "This will create shortcuts, icons and desktop files for this appimage",
-		}
-		err = survey.AskOne(integrateEnabledPrompt, &integrateEnabled)
-		if err != nil {
-			logger.Warnf("Failed to ask prompt, %s", err)
+	if appimage.Integration != IntegrationEnabled {
+		desktopEntry := desktopFile.Section("Desktop Entry")
+
+		// the appimage has explicitly requested not to be integrated
+		if optsOutOfIntegration(desktopEntry) {
+			fmt.Printf("%s has asked not to be integrated, run %s to integrate it anyway\n",
+				tui.Yellow(appimage.Executable), tui.Green(fmt.Sprintf("zap integrate %s", appimage.Executable)))
 			return
 		}
-		if !integrateEnabled {
-			// user has asked not to integrate the appimage explicitly
+
+		if cfg.Integrate == config.IntegrateNever {
+			// user has configured not to integrate
+			// newly installed appimages
+			appimage.Integration = IntegrationDisabled
 			return
 		}
-	}
 
-	appImageIcon := desktopEntry.Key("Icon").String()
-	desktopEntry.Key("X-Zap-Id").SetValue(appimage.Executable)
-
-	// This does patch https://github.com/srevinsaju/zap/issues/92
-	// but, we use zap's saved icon for custom icon theme
-	if cfg.CustomIconTheme {
-		desktopEntry.Key("Icon").SetValue(appImageIcon)
-	} else {
-		desktopEntry.Key("Icon").SetValue(appimage.IconPath)
+		if cfg.Integrate == config.IntegrateAsk {
+			integrateEnabled := false
+			integrateEnabledPrompt := &survey.Confirm{
+				Message: "Do you want to integrate this appimage?",
+				Help:    "This will create shortcuts, icons and desktop files for this appimage",
+			}
+			err = survey.AskOne(integrateEnabledPrompt, &integrateEnabled)
+			if err != nil {
+				logger.Warnf("Failed to ask prompt, %s", err)
+				return
+			}
+			if !integrateEnabled {
+				// user has asked not to integrate the appimage explicitly
+				appimage.Integration = IntegrationDisabled
+				return
+			}
+		}
 	}
 
-	// set the name again, so that the name looks like
-	// Name = appimagetool (AppImage)
-	// as an identifier
-	name := desktopEntry.Key("Name").String()
-	desktopEntry.Key("Name").SetValue(fmt.Sprintf("%s (AppImage)", name))
-
-	// add Exec
-	binDir := path.Join(xdg.Home, ".local", "bin")
-	binFile := path.Join(binDir, appimage.Executable)
-	desktopEntry.Key("Exec").SetValue(fmt.Sprintf("%s %%U", binFile))
-	desktopEntry.Key("TryExec").SetValue(binFile)
-
-	tempDesktopDir := path.Join(cfg.LocalStore, "desktop")
-	os.MkdirAll(tempDesktopDir, 0755)
-
-	targetDesktopFile := path.Join(tempDesktopDir, fmt.Sprintf("%s.desktop", appimage.Executable))
-	logger.Debugf("Preparing %s for writing new desktop file", targetDesktopFile)
-
-	err = desktopFile.SaveTo(targetDesktopFile)
-	if err != nil {
-		logger.Debugf("desktop file could not be saved to %s", targetDesktopFile)
-		return
+	err = appimage.integrate(cfg, desktopFile)
+	if err != nil && err != errNotShown {
+		logger.Warnf("Not integrating %s with the desktop, %s", appimage.Executable, err)
 	}
-	appimage.DesktopFile = targetDesktopFile
-
-	xdgDesktopMenuInstall(targetDesktopFile)
-
-	// and they completed, happily ever after
-	logger.Debugf("Desktop file successfully written to %s, and installed with 'xdg-desktop-menu'", targetDesktopFile)
 }
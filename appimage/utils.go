@@ -11,12 +11,12 @@ import (
 	"path"
 	"path/filepath"
 	"strings"
-	"syscall"
 	"time"
 
 	"github.com/AlecAivazis/survey/v2"
 	"github.com/adrg/xdg"
 	au "github.com/srevinsaju/appimage-update"
+	"github.com/srevinsaju/zap/cache"
 	"github.com/srevinsaju/zap/config"
 	"github.com/srevinsaju/zap/index"
 	"github.com/srevinsaju/zap/internal/helpers"
@@ -83,10 +83,15 @@ func Install(options types.InstallOptions, config config.Store) error {
 
 	// check if the app is already installed
 	// if it is, do not continue
-	if helpers.CheckIfFileExists(indexFile) && !options.UpdateInplace {
+	if helpers.CheckIfFileExists(indexFile) && !options.UpdateInplace && !options.RemovePreviousVersions {
 		fmt.Printf("%s is already installed \n", tui.Yellow(options.Executable))
 		return nil
 	}
+
+	// the choices the user made for the previous version,
+	// are carried over to the new version
+	previous, _ := loadIndex(options.Executable, config)
+	extract := options.Extract || config.ExtractAppImages || (previous != nil && previous.Extracted != "")
 	if options.RemovePreviousVersions {
 		err := Remove(options.ToRemoveOptions(), config)
 		if err != nil {
@@ -94,6 +99,20 @@ func Install(options types.InstallOptions, config config.Store) error {
 		}
 	}
 
+	// the launcher of the previous version is replaced by the new
+	// one, otherwise it has to be checked that the launcher does not
+	// replace, or shadow anything which was not installed by zap
+	replaceLauncher := false
+	if previous == nil {
+		executable := ""
+		executable, replaceLauncher, err = AppImage{}.resolveExecutableConflict(options.Executable,
+			options.ExecutableConflict, !options.Silent, config)
+		if err != nil || executable == "" {
+			return err
+		}
+		options.Executable = executable
+	}
+
 	if options.FromGithub {
 		asset, err = index.GitHubSurveyUserReleases(options, config)
 		sourceSlug = options.From
@@ -104,9 +123,15 @@ func Install(options types.InstallOptions, config config.Store) error {
 	} else if options.From == "" {
 		sourceIdentifier = SourceZapIndex
 		sourceSlug = options.Name
-		asset, err = index.ZapSurveyUserReleases(options, config)
-		if err != nil {
-			return err
+		if options.Asset != nil {
+			// the asset has already been resolved from the zap index,
+			// for example, when installing from a bundle
+			asset = *options.Asset
+		} else {
+			asset, err = index.ZapSurveyUserReleases(options, config)
+			if err != nil {
+				return err
+			}
 		}
 	} else {
 		sourceIdentifier = SourceDirectURL
@@ -145,9 +170,23 @@ func Install(options types.InstallOptions, config config.Store) error {
 
 	logger.Debugf("Connecting to %s", asset.Download)
 
-	targetAppImagePath := path.Join(config.LocalStore, asset.GetBaseName())
+	// the new version of an appimage adopted where it is, replaces it there
+	storeDir := config.LocalStore
+	if previous != nil && previous.adoptedInPlace(config) {
+		storeDir = path.Dir(previous.Filepath)
+	}
+	targetAppImagePath := path.Join(storeDir, asset.GetBaseName())
+	if extract && asset.GetBaseName() == options.Executable {
+		// the appimage is extracted into LocalStore/<executable>
+		targetAppImagePath = fmt.Sprintf("%s.AppImage", targetAppImagePath)
+	}
 	if options.UpdateInplace {
-		file, _ := os.CreateTemp(config.LocalStore, "temp*.AppImage")
+		file, err := os.CreateTemp(config.LocalStore, "temp*.AppImage")
+		if err != nil {
+			return err
+		}
+		// the appimage cannot be executed while it is open for writing
+		_ = file.Close()
 		tmpTargetImagePath = targetAppImagePath
 		targetAppImagePath = file.Name()
 	}
@@ -170,7 +209,10 @@ func Install(options types.InstallOptions, config config.Store) error {
 		}
 
 	} else {
-		err = tui.DownloadFileWithProgressBar(asset.Download, targetAppImagePath, options.Executable)
+		err = tui.DownloadFileWithProgressBar(asset.Download, targetAppImagePath, options.Executable, tui.DownloadOptions{
+			Cache:  cache.New(config),
+			Sha256: asset.Sha256,
+		})
 		if err != nil {
 			return err
 		}
@@ -178,7 +220,7 @@ func Install(options types.InstallOptions, config config.Store) error {
 
 	if options.UpdateInplace {
 		logger.Debugf("Renaming %s to %s", targetAppImagePath, tmpTargetImagePath)
-		err = os.Rename(targetAppImagePath, tmpTargetImagePath)
+		err = moveFile(targetAppImagePath, tmpTargetImagePath)
 		if err != nil {
 			logger.Fatalf("Failed to update appimage in place: %s -> %s", targetAppImagePath, tmpTargetImagePath)
 		}
@@ -208,19 +250,42 @@ func Install(options types.InstallOptions, config config.Store) error {
 		Meta: SourceMetadata{
 			Slug:      sourceSlug,
 			CrawledOn: time.Now().String(),
+			Tag:       options.Tag,
+			Upstream:  options.Source,
 		},
 	}
+	app.Sha256, err = helpers.Sha256File(targetAppImagePath)
+	if err != nil {
+		return err
+	}
+	if previous != nil {
+		app.carryOver(previous)
+		app.migratePortableDirs(previous.Filepath)
+	}
+
+	if extract {
+		app.Extracted, err = app.extractTree(config)
+		if err != nil {
+			return err
+		}
+	} else if !fuseAvailable() {
+		suggestExtractMode(app.Executable)
+	}
 
 	app.ExtractThumbnail(config.IconStore)
+	if app.IconPath == "" && options.Icon != "" {
+		targetIconPath := path.Join(config.IconStore, app.Executable+path.Ext(options.Icon))
+		_, err = helpers.CopyFile(options.Icon, targetIconPath)
+		if err != nil {
+			logger.Warnf("copying the icon from the index failed %s", err)
+		} else {
+			app.IconPath = targetIconPath
+		}
+	}
+	app.installShellFiles(config)
 	app.ProcessDesktopFile(config)
 
-	indexBytes, err := json.Marshal(*app)
-	if err != nil {
-		return err
-	}
-	indexFile = fmt.Sprintf("%s.json", path.Join(config.IndexStore, options.Executable))
-	logger.Debugf("Writing JSON index to %s", indexFile)
-	err = os.WriteFile(indexFile, indexBytes, 0644)
+	err = saveIndex(app, config)
 	if err != nil {
 		return err
 	}
@@ -234,43 +299,11 @@ func Install(options types.InstallOptions, config config.Store) error {
 			return err
 		}
 	}
-	if helpers.CheckIfSymlinkExists(binFile) {
-		logger.Debugf("%s file exists. Attempting to find path", binFile)
-		binAbsPath, err := filepath.EvalSymlinks(binFile)
-		logger.Debugf("%s file is evaluated to %s", binFile, binAbsPath)
-		if err == nil && strings.HasPrefix(binAbsPath, config.LocalStore) {
-			// this link points to config.LocalStore, where all AppImages are stored
-			// I guess we need to remove them, no asking and all
-			// make sure we remove the file first to prevent conflicts in future
-			logger.Debugf("%s is a previously installed symlink because of zap. Attempting to remove it", binFile)
-			err := os.Remove(binFile)
-			if err != nil {
-				logger.Warnf("Failed to remove the symlink. %s", err)
-			}
-		} else if err == nil {
-			// this is some serious app which shares the same name
-			// as that of the target appimage
-			// we don't want users to be confused tbh
-			// so, we need to ask them which of them, they would like to keep
-			logger.Debug("Detected another app which is not installed by zap. Refusing to remove")
-			// TODO: add a user prompt
-			logger.Fatalf("%s already exists. ", binFile)
-		} else {
-			// the file is probably a symlink, but just doesnt resolve properly
-			// we can safely remove it
-
-			// make sure we remove the file first to prevent conflicts
-			logger.Debugf("Failed to evaluate target of symlink")
-			logger.Debugf("Attempting to remove the symlink regardless")
-			err := os.Remove(binFile)
-			if err != nil {
-				logger.Debugf("Failed to remove symlink using os.Remove: %s", err)
-				err = syscall.Unlink(binFile)
-				if err != nil {
-					logger.Debugf("Failed to remove symlink using syscall.Unlink: %s", err)
-				}
-
-			}
+	if replaceLauncher {
+		logger.Debugf("Replacing %s, on user request", binFile)
+		err = os.Remove(binFile)
+		if err != nil {
+			return err
 		}
 	}
 
@@ -280,12 +313,19 @@ func Install(options types.InstallOptions, config config.Store) error {
 			"See https://linuxize.com/post/how-to-add-directory-to-path-in-linux/")
 	}
 
-	logger.Debugf("Creating symlink to %s", binFile)
-	err = os.Symlink(targetAppImagePath, binFile)
+	err = app.refreshLauncher(config)
 	if err != nil {
 		return err
 	}
 
+	if app.Autostart {
+		// the name or icon of the new version may have changed
+		err = app.installAutostart()
+		if err != nil {
+			logger.Warnf("Failed to update the autostart entry, %s", err)
+		}
+	}
+
 	// <- finished
 	logger.Debug("Completed all tasks")
 
@@ -355,23 +395,20 @@ func RemoveAndInstall(options types.InstallOptions, config config.Store, app *Ap
 	// appimage before continuing, because there is no verification
 	// of the method which can be used to check if the appimage is up-to-date
 	// or not.
-	err := Remove(types.RemoveOptions{Executable: app.Executable}, config)
-	if err != nil {
-		return nil, err
-	}
-	err = Install(options, config)
+	options.RemovePreviousVersions = true
+	err := Install(options, config)
 	if err != nil {
 		return nil, err
 	}
 
-	// after installing, we need to resolve the name of the new app
-	binDir := path.Join(xdg.Home, ".local", "bin")
-	binFile := path.Join(binDir, app.Executable)
-	app.Filepath, err = filepath.EvalSymlinks(binFile)
+	// after installing, we need to resolve the name of the new app,
+	// the launcher in ~/.local/bin is not always a symlink to it
+	newApp, err := loadIndex(app.Executable, config)
 	if err != nil {
-		logger.Fatalf("Failed to resolve symlink to %s. E: %s", binDir, err)
+		logger.Fatalf("Failed to read the index of %s. E: %s", app.Executable, err)
 		return nil, err
 	}
+	app.Filepath = newApp.Filepath
 	return app, err
 }
 
@@ -383,13 +420,14 @@ func UpdateInPlace(options types.InstallOptions, config config.Store, app *AppIm
 		return nil, err
 	}
 
-	// after installing, we need to resolve the name of the new app
-	binDir := path.Join(xdg.Home, ".local", "bin")
-	binFile := path.Join(binDir, app.Executable)
-	app.Filepath, err = filepath.EvalSymlinks(binFile)
+	// after installing, we need to resolve the name of the new app,
+	// the launcher in ~/.local/bin is not always a symlink to it
+	newApp, err := loadIndex(app.Executable, config)
 	if err != nil {
-		logger.Warnf("Failed to resolve symlink to %s. E: %s", binFile, err)
+		logger.Warnf("Failed to read the index of %s. E: %s", app.Executable, err)
 		logger.Infof("Found existing corrupted installation for %s. Overwriting...", app.Executable)
+	} else {
+		app.Filepath = newApp.Filepath
 	}
 	return app, nil
 }
@@ -416,7 +454,10 @@ func update(options types.Options, config config.Store) (*AppImage, error) {
 		return app, err
 	}
 
-	if !options.UseAppImageUpdate || !checkIfUpdateInformationExists(app.Filepath) {
+	// adopted appimages are updated with their update information, which
+	// picks the same asset, like the file name pattern of gh-releases-zsync
+	useAppImageUpdate := options.UseAppImageUpdate || app.Source.Meta.URL != ""
+	if !useAppImageUpdate || !checkIfUpdateInformationExists(app.Filepath) {
 		funcToApply := UpdateInPlace
 		if options.ForceRemove {
 			funcToApply = RemoveAndInstall
@@ -481,24 +522,41 @@ func update(options types.Options, config config.Store) (*AppImage, error) {
 	newFileName, err := updater.Download()
 	fmt.Print("\n")
 
+	previousFilepath := app.Filepath
 	app.Filepath = newFileName
+	app.migratePortableDirs(previousFilepath)
 	_ = os.Remove(app.IconPath)
-	_ = os.Remove(app.DesktopFile)
+	app.removeIntegration(config, true)
+	app.uninstallShellFiles()
 	app.ExtractThumbnail(config.IconStore)
+	app.installShellFiles(config)
 	app.ProcessDesktopFile(config)
 
 	if err != nil {
 		return app, err
 	}
 
-	logger.Debug("Saving new index as JSON")
-	newIdxBytes, err := json.Marshal(*app)
+	app.Sha256, err = helpers.Sha256File(app.Filepath)
 	if err != nil {
 		return app, err
 	}
+	app.Broken = nil
+
+	if app.Extracted != "" {
+		app.Extracted, err = app.extractTree(config)
+		if err != nil {
+			return app, err
+		}
+	}
+
+	// the launcher has to point to the new appimage
+	err = app.refreshLauncher(config)
+	if err != nil {
+		logger.Warnf("Failed to update the launcher of %s, %s", app.Executable, err)
+	}
 
-	logger.Debugf("Writing to %s", indexFile)
-	err = os.WriteFile(indexFile, newIdxBytes, 0644)
+	logger.Debug("Saving new index as JSON")
+	err = saveIndex(app, config)
 	if err != nil {
 		return app, err
 	}
@@ -509,31 +567,38 @@ func update(options types.Options, config config.Store) (*AppImage, error) {
 // checkIfUpdateInformationExists checks if the appimage contains Update Information
 // adapted directly from https://github.com/AppImageCrafters/appimage-update
 func checkIfUpdateInformationExists(f string) bool {
+	return updateInformation(f) != ""
+}
+
+// updateInformation returns the update information embedded in the
+// .upd_info section of the appimage, or an empty string if there is none
+func updateInformation(f string) string {
 	elfFile, err := elf.Open(f)
 	if err != nil {
-		panic("Unable to open target: \"" + f + "\"." + err.Error())
+		logger.Debugf("Unable to open %s, %s", f, err)
+		return ""
 	}
-	updInfo := elfFile.Section(".upd_info")
+	defer elfFile.Close()
 
+	updInfo := elfFile.Section(".upd_info")
+	if updInfo == nil {
+		return ""
+	}
 	sectionData, err := updInfo.Data()
 	if err != nil {
-		return false
+		return ""
 	}
 
 	strEnd := bytes.Index(sectionData, []byte("\000"))
-	return updInfo != nil && strEnd != -1 && strEnd != 0
+	if strEnd == -1 {
+		return ""
+	}
+	return string(sectionData[:strEnd])
 }
 
 // Remove function helps to remove an appimage, given its executable name
 // with which it was registered
 func Remove(options types.RemoveOptions, config config.Store) error {
-	// check for dependencies
-	if !commandExists("xdg-desktop-menu") {
-		logger.Fatal("Could not find 'xdg-desktop-menu' on your system. " +
-			"Please refer to https://command-not-found.com/xdg-desktop-menu " +
-			"for more information.")
-	}
-
 	app := &AppImage{}
 
 	indexFile := fmt.Sprintf("%s.json", path.Join(config.IndexStore, options.Executable))
@@ -543,7 +608,7 @@ func Remove(options types.RemoveOptions, config config.Store) error {
 		return nil
 	}
 
-	bar := tui.NewProgressBar(7, "r")
+	bar := tui.NewProgressBar(6, "r")
 
 	logger.Debugf("Unmarshalling JSON from %s", indexFile)
 	indexBytes, err := os.ReadFile(indexFile)
@@ -563,36 +628,34 @@ func Remove(options types.RemoveOptions, config config.Store) error {
 	}
 	_ = bar.Add(1)
 
-	if app.IconPathHicolor != "" {
-		logger.Debugf("Removing symlink to hicolor theme, %s", app.IconPathHicolor)
-		_ = os.Remove(app.IconPathHicolor)
-	}
-	_ = bar.Add(1)
+	// the default applications are kept for the new version
+	// of the app, which has the same desktop file
+	app.removeIntegration(config, options.KeepSettings || options.RemoveInPlace)
+	app.uninstallShellFiles()
 
-	if app.DesktopFile != "" {
-		logger.Debugf("Removing desktop file, %s", app.DesktopFile)
-		xdgDesktopMenuUninstall(app.DesktopFile)
-		_ = os.Remove(app.DesktopFile)
+	// the autostart entry launches ~/.local/bin, which
+	// is kept for the new version of the app
+	if app.Autostart && !options.KeepSettings && !options.RemoveInPlace {
+		uninstallAutostart(app.Executable)
 	}
 	_ = bar.Add(1)
 
-	binDir := path.Join(xdg.Home, ".local", "bin")
-	binFile := path.Join(binDir, options.Executable)
+	app.removeLauncher(config)
+	_ = bar.Add(1)
 
-	if helpers.CheckIfFileExists(binFile) {
-		binAbsPath, err := filepath.EvalSymlinks(binFile)
-		if err == nil && strings.HasPrefix(binAbsPath, config.LocalStore) {
-			// this link points to config.LocalStore, where all AppImages are stored
-			// I guess we need to remove them, no asking and all
-			// make sure we remove the file first to prevent conflicts in future
-			_ = os.Remove(binFile)
-		}
+	// the extracted tree is replaced by the new version of the app
+	if !options.RemoveInPlace {
+		app.removeExtractedTree(config)
 	}
-	_ = bar.Add(1)
 
 	// the appimage file name hasn't changed over time
-	// so we can remove it in place
-	if !options.RemoveInPlace || options.NewFilepath != app.Filepath {
+	// so we can remove it in place. Appimages adopted where they are
+	// belong to the user, and are only removed for their new version
+	if app.adoptedInPlace(config) && !options.RemoveInPlace && !options.KeepSettings {
+		if helpers.CheckIfFileExists(app.Filepath) {
+			fmt.Printf("Keeping %s\n", tui.Yellow(app.Filepath))
+		}
+	} else if !options.RemoveInPlace || options.NewFilepath != app.Filepath {
 		logger.Debugf("Removing appimage, %s", app.Filepath)
 		_ = os.Remove(app.Filepath)
 	} else {
@@ -606,6 +669,12 @@ func Remove(options types.RemoveOptions, config config.Store) error {
 
 	_ = bar.Finish()
 	fmt.Printf("\n")
+
+	// the portable directories are moved to the new version of the app
+	if !options.KeepSettings && !options.RemoveInPlace {
+		app.removePortableDirs()
+	}
+
 	fmt.Printf("✅ %s removed successfully\n", app.Executable)
 	logger.Debugf("Removing all files completed successfully")
 
@@ -0,0 +1,263 @@
+package appimage
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/srevinsaju/zap/config"
+	"github.com/srevinsaju/zap/internal/helpers"
+	"github.com/srevinsaju/zap/tui"
+)
+
+// relocate rewrites the paths in the index of the appimage, if LocalStore
+// has moved since it was installed, for example, because the home directory
+// was moved. It returns true if the paths were rewritten
+func (appimage *AppImage) relocate(cfg config.Store) bool {
+	oldStore := path.Dir(appimage.Filepath)
+	newStore := path.Clean(cfg.LocalStore)
+	if oldStore == newStore || helpers.CheckIfFileExists(appimage.Filepath) ||
+		!helpers.CheckIfFileExists(path.Join(newStore, path.Base(appimage.Filepath))) {
+		return false
+	}
+
+	// the paths LocalStore has in common, like .local/share/zap/v2, are
+	// stripped, to find the directory which was moved, like the home
+	// directory, which the desktop files and icons were moved along with
+	oldPrefix, newPrefix := oldStore, newStore
+	for path.Base(oldPrefix) == path.Base(newPrefix) && oldPrefix != "/" && newPrefix != "/" {
+		oldPrefix, newPrefix = path.Dir(oldPrefix), path.Dir(newPrefix)
+	}
+	logger.Debugf("%s has moved to %s", oldPrefix, newPrefix)
+
+	move := func(p string) string {
+		if p != oldPrefix && !strings.HasPrefix(p, oldPrefix+"/") {
+			return p
+		}
+		return path.Join(newPrefix, strings.TrimPrefix(p, oldPrefix))
+	}
+	moveAll := func(paths []string) []string {
+		var moved []string
+		for _, p := range paths {
+			moved = append(moved, move(p))
+		}
+		return moved
+	}
+
+	appimage.Filepath = move(appimage.Filepath)
+	appimage.IconPath = move(appimage.IconPath)
+	appimage.IconPathHicolor = move(appimage.IconPathHicolor)
+	appimage.DesktopFile = move(appimage.DesktopFile)
+	appimage.Extracted = move(appimage.Extracted)
+	appimage.Launch.WorkingDir = move(appimage.Launch.WorkingDir)
+	appimage.Icons = moveAll(appimage.Icons)
+	appimage.MimePackages = moveAll(appimage.MimePackages)
+	appimage.Completions = moveAll(appimage.Completions)
+	appimage.ManPages = moveAll(appimage.ManPages)
+	return true
+}
+
+// verifyLauncher checks that the launcher in ~/.local/bin launches the
+// appimage, and returns the problem, if it does not
+func (appimage AppImage) verifyLauncher(cfg config.Store) string {
+	binFile := binFilePath(appimage.Executable)
+	if _, err := os.Lstat(binFile); err != nil {
+		return fmt.Sprintf("launcher %s does not exist", binFile)
+	}
+
+	script, err := appimage.launcher(cfg)
+	if err != nil {
+		return fmt.Sprintf("launcher %s cannot be created, %s", binFile, err)
+	}
+	if script != nil {
+		if !isLauncherScript(binFile) {
+			return fmt.Sprintf("launcher %s was not created by zap", binFile)
+		}
+		installed, err := os.ReadFile(binFile)
+		if err != nil || !bytes.Equal(installed, script) {
+			return fmt.Sprintf("launcher %s is out of date", binFile)
+		}
+		return ""
+	}
+
+	target, err := filepath.EvalSymlinks(binFile)
+	if err != nil {
+		return fmt.Sprintf("launcher %s does not resolve, %s", binFile, err)
+	}
+	appImagePath, err := filepath.EvalSymlinks(appimage.Filepath)
+	if err != nil || target != appImagePath {
+		return fmt.Sprintf("launcher %s points to %s, not into %s", binFile, target, cfg.LocalStore)
+	}
+	return ""
+}
+
+// verify checks the installation of the appimage against its index,
+// and returns the problems it finds
+func (appimage AppImage) verify(cfg config.Store) []string {
+	relocated := appimage
+	if relocated.relocate(cfg) {
+		return []string{fmt.Sprintf("%s has moved to %s", appimage.Filepath, relocated.Filepath)}
+	}
+	if !helpers.CheckIfFileExists(appimage.Filepath) {
+		return []string{fmt.Sprintf("%s does not exist", appimage.Filepath)}
+	}
+
+	var problems []string
+	if appimage.Sha256 != "" {
+		sum, err := helpers.Sha256File(appimage.Filepath)
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("%s cannot be read, %s", appimage.Filepath, err))
+		} else if !strings.EqualFold(sum, appimage.Sha256) {
+			problems = append(problems, fmt.Sprintf("sha256 of %s is %s, expected %s", appimage.Filepath, sum, appimage.Sha256))
+		}
+	}
+	if appimage.Extracted != "" && !helpers.CheckIfFileExists(path.Join(appimage.Extracted, "AppRun")) {
+		problems = append(problems, fmt.Sprintf("extracted tree %s does not exist", appimage.Extracted))
+	}
+	if problem := appimage.verifyLauncher(cfg); problem != "" {
+		problems = append(problems, problem)
+	}
+	if appimage.IconPath != "" && !helpers.CheckIfFileExists(appimage.IconPath) {
+		problems = append(problems, fmt.Sprintf("icon %s does not exist", appimage.IconPath))
+	}
+	if appimage.DesktopFile != "" && !helpers.CheckIfFileExists(appimage.DesktopFile) {
+		problems = append(problems, fmt.Sprintf("desktop file %s does not exist", appimage.DesktopFile))
+	}
+	for _, icon := range appimage.Icons {
+		if !helpers.CheckIfFileExists(icon) {
+			problems = append(problems, fmt.Sprintf("icon %s does not exist", icon))
+		}
+	}
+	if appimage.Autostart && !helpers.CheckIfFileExists(autostartFilePath(appimage.Executable)) {
+		problems = append(problems, fmt.Sprintf("autostart entry %s does not exist", autostartFilePath(appimage.Executable)))
+	}
+	return problems
+}
+
+// repair recreates what is missing from the installation of the appimage,
+// from the appimage, and returns the problems it could not fix
+func (appimage *AppImage) repair(cfg config.Store) []string {
+	// the desktop file launches the appimage through
+	// its old path, so it is integrated again
+	reintegrate := appimage.relocate(cfg)
+
+	if !helpers.CheckIfFileExists(appimage.Filepath) {
+		return appimage.verify(cfg)
+	}
+	sum, err := helpers.Sha256File(appimage.Filepath)
+	if err != nil {
+		return appimage.verify(cfg)
+	}
+	if appimage.Sha256 == "" {
+		// indexes written by older versions of zap
+		// do not record the checksum
+		appimage.Sha256 = sum
+	} else if !strings.EqualFold(sum, appimage.Sha256) {
+		// the appimage has been changed, it is not trusted
+		// to recreate the rest of the installation
+		return appimage.verify(cfg)
+	}
+
+	if appimage.Extracted != "" && !helpers.CheckIfFileExists(path.Join(appimage.Extracted, "AppRun")) {
+		extracted, err := appimage.extractTree(cfg)
+		if err != nil {
+			logger.Warnf("Failed to extract %s, %s", appimage.Filepath, err)
+		} else {
+			appimage.Extracted = extracted
+		}
+	}
+
+	if appimage.IconPath != "" && !helpers.CheckIfFileExists(appimage.IconPath) {
+		appimage.ExtractThumbnail(cfg.IconStore)
+		reintegrate = true
+	}
+	if appimage.DesktopFile != "" && !helpers.CheckIfFileExists(appimage.DesktopFile) {
+		reintegrate = true
+	}
+	for _, icon := range appimage.Icons {
+		if !helpers.CheckIfFileExists(icon) {
+			reintegrate = true
+		}
+	}
+	if reintegrate && appimage.isIntegrated() {
+		desktopFile, err := appimage.loadDesktopFile()
+		if err != nil {
+			logger.Warnf("Failed to read the desktop file of %s, %s", appimage.Executable, err)
+		} else {
+			appimage.removeIntegration(cfg, true)
+			err = appimage.integrate(cfg, desktopFile)
+			if err != nil && err != errNotShown {
+				logger.Warnf("Failed to integrate %s again, %s", appimage.Executable, err)
+			}
+		}
+	}
+
+	if appimage.verifyLauncher(cfg) != "" {
+		err := appimage.refreshLauncher(cfg)
+		if err != nil {
+			logger.Warnf("Failed to recreate the launcher of %s, %s", appimage.Executable, err)
+		}
+	}
+
+	if appimage.Autostart && (reintegrate || !helpers.CheckIfFileExists(autostartFilePath(appimage.Executable))) {
+		err := appimage.installAutostart()
+		if err != nil {
+			logger.Warnf("Failed to recreate the autostart entry of %s, %s", appimage.Executable, err)
+		}
+	}
+	return appimage.verify(cfg)
+}
+
+// Verify checks that the appimage, its launcher, desktop file and icons
+// of an installed app exist, and that the appimage has not changed since
+// it was installed. It prints the problems it finds, and returns false
+// if there are any
+func Verify(executable string, config config.Store) (bool, error) {
+	app, err := loadIndex(executable, config)
+	if err != nil {
+		return false, err
+	}
+
+	appFormatted := fmt.Sprintf("[%s]", executable)
+	problems := app.verify(config)
+	if len(problems) == 0 {
+		fmt.Printf("%s%s OK\n", tui.Blue("[verify]"), tui.Green(appFormatted))
+		return true, nil
+	}
+	for _, problem := range problems {
+		fmt.Printf("%s%s %s\n", tui.Blue("[verify]"), tui.Red(appFormatted), tui.Yellow(problem))
+	}
+	return false, nil
+}
+
+// Repair recreates the launcher, desktop file, icons and extracted tree
+// of an installed app from its appimage, and updates its index, if the
+// home directory has moved. The problems which cannot be fixed are
+// recorded in the index, and it returns false if there are any
+func Repair(executable string, config config.Store) (bool, error) {
+	app, err := loadIndex(executable, config)
+	if err != nil {
+		return false, err
+	}
+
+	appFormatted := fmt.Sprintf("[%s]", executable)
+	app.Broken = app.repair(config)
+	err = saveIndex(app, config)
+	if err != nil {
+		return false, err
+	}
+
+	if len(app.Broken) == 0 {
+		fmt.Printf("%s%s OK\n", tui.Blue("[repair]"), tui.Green(appFormatted))
+		return true, nil
+	}
+	for _, problem := range app.Broken {
+		fmt.Printf("%s%s %s\n", tui.Blue("[repair]"), tui.Red(appFormatted), tui.Yellow(problem))
+	}
+	fmt.Printf("%s%s Broken, remove it with %s, and install it again\n", tui.Blue("[repair]"), tui.Red(appFormatted),
+		tui.Green(fmt.Sprintf("zap remove %s", executable)))
+	return false, nil
+}
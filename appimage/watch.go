@@ -0,0 +1,91 @@
+package appimage
+
+import (
+	"fmt"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/srevinsaju/zap/config"
+	"github.com/srevinsaju/zap/internal/helpers"
+	"github.com/srevinsaju/zap/tui"
+	"github.com/srevinsaju/zap/types"
+)
+
+// moved updates the installation of the appimage, which was moved to file
+func (appimage *AppImage) moved(file string, cfg config.Store) error {
+	previousFilepath := appimage.Filepath
+	appimage.Filepath = file
+	appimage.migratePortableDirs(previousFilepath)
+	if appimage.Source.Identifier == SourceDirectURL && appimage.Source.Meta.Slug == fmt.Sprintf("file://%s", previousFilepath) {
+		appimage.Source.Meta.Slug = fmt.Sprintf("file://%s", file)
+	}
+
+	err := saveIndex(appimage, cfg)
+	if err != nil {
+		return err
+	}
+	// the desktop file launches the appimage through
+	// its launcher, which is the only one to follow it
+	err = appimage.refreshLauncher(cfg)
+	if err != nil {
+		logger.Warnf("Failed to update the launcher of %s, %s", appimage.Executable, err)
+	}
+
+	fmt.Printf("✨ %s has moved to %s\n", tui.Green(appimage.Executable), file)
+	return nil
+}
+
+// WatchCreated installs and integrates the appimage at file, which appeared
+// in a watched directory. If it has the same content as an installed
+// appimage which has disappeared, it was moved, and the installation
+// follows it instead
+func WatchCreated(file string, config config.Store) error {
+	file, err := filepath.Abs(file)
+	if err != nil {
+		return err
+	}
+	// zap downloads the appimages it installs into LocalStore
+	if strings.HasPrefix(file, path.Clean(config.LocalStore)+"/") {
+		return nil
+	}
+	if !isAppImageCandidate(file) || adoptedExecutable(file, config) != "" {
+		return nil
+	}
+
+	sum, err := helpers.Sha256File(file)
+	if err != nil {
+		return err
+	}
+	apps, err := List(config, false)
+	if err != nil {
+		return err
+	}
+	for _, executable := range apps {
+		app, err := loadIndex(executable, config)
+		if err != nil || !strings.EqualFold(app.Sha256, sum) || helpers.CheckIfFileExists(app.Filepath) {
+			continue
+		}
+		return app.moved(file, config)
+	}
+
+	return Adopt(file, types.AdoptOptions{Integrate: true, Silent: true}, config)
+}
+
+// WatchRemoved removes the app installed from file, which disappeared
+// from a watched directory
+func WatchRemoved(file string, config config.Store) error {
+	file, err := filepath.Abs(file)
+	if err != nil {
+		return err
+	}
+	// it has been replaced, or moved back
+	if helpers.CheckIfFileExists(file) {
+		return nil
+	}
+	executable := adoptedExecutable(file, config)
+	if executable == "" {
+		return nil
+	}
+	return Remove(types.RemoveOptions{Executable: executable}, config)
+}
@@ -0,0 +1,280 @@
+package bundle
+
+import (
+	"archive/tar"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/srevinsaju/zap/cache"
+	"github.com/srevinsaju/zap/config"
+	"github.com/srevinsaju/zap/index"
+	"github.com/srevinsaju/zap/internal/helpers"
+	"github.com/srevinsaju/zap/tui"
+	"github.com/srevinsaju/zap/types"
+)
+
+// CreateOptions configures Create
+type CreateOptions struct {
+	Apps   []string
+	Output string
+
+	// Arch is the architecture of the machine the bundle will be
+	// installed on, defaults to the architecture zap is running on
+	Arch string
+}
+
+// Create resolves the latest release of each of the apps from the zap
+// index, and packs the AppImages, their index records, icons and
+// checksums into a tar archive, which can be installed without network
+// access with Install
+func Create(options CreateOptions, config config.Store) error {
+	goarch := runtime.GOARCH
+	if options.Arch != "" {
+		var err error
+		goarch, err = helpers.NormalizeArch(options.Arch)
+		if err != nil {
+			return err
+		}
+	}
+
+	staging, err := os.MkdirTemp("", "zap-bundle")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(staging)
+
+	// the index is only used for the icons, so we can do without
+	images := map[string]string{}
+	indexBytes, err := index.Fetch(config.MirrorRoot, func(mirror string) string {
+		return fmt.Sprintf("%s/%s", mirror, "index.min.json")
+	})
+	if err == nil {
+		var apps []types.ZapIndex
+		if json.Unmarshal(indexBytes, &apps) == nil {
+			for i := range apps {
+				images[apps[i].Id] = apps[i].Image
+			}
+		}
+	} else {
+		logger.Warnf("Could not fetch the index, icons will not be bundled, %s", err)
+	}
+
+	manifest := Manifest{
+		Version:   1,
+		Arch:      goarch,
+		CreatedOn: time.Now().UTC().Format(time.RFC3339),
+	}
+
+	for _, id := range options.Apps {
+		id = strings.TrimSpace(id)
+		if id == "" {
+			continue
+		}
+		fmt.Printf("%s[%s] Resolving\n", tui.Blue("[bundle]"), tui.Yellow(id))
+
+		coreBytes, err := index.FetchZapRecord(id, config)
+		if err != nil {
+			return fmt.Errorf("failed to fetch %s from the index, %s", id, err)
+		}
+		releases, err := index.ParseZapReleases(coreBytes)
+		if err != nil {
+			return err
+		}
+		if len(releases.Releases) == 0 {
+			return fmt.Errorf("%s has no releases", id)
+		}
+		release := releases.Releases[0]
+
+		asset, err := selectAsset(release.Assets, goarch)
+		if err != nil {
+			return fmt.Errorf("%s %s: %s", id, release.Tag, err)
+		}
+
+		appDir := path.Join("apps", id)
+		err = os.MkdirAll(filepath.Join(staging, appDir), 0755)
+		if err != nil {
+			return err
+		}
+
+		bundledApp := BundledApp{
+			Id:        id,
+			Tag:       release.Tag,
+			Asset:     asset,
+			File:      path.Join(appDir, asset.GetBaseName()),
+			IndexFile: path.Join(appDir, "core.json"),
+		}
+
+		err = os.WriteFile(filepath.Join(staging, bundledApp.IndexFile), coreBytes, 0644)
+		if err != nil {
+			return err
+		}
+
+		target := filepath.Join(staging, bundledApp.File)
+		err = tui.DownloadFileWithProgressBar(asset.Download, target, asset.Name, tui.DownloadOptions{
+			Cache:  cache.New(config),
+			Sha256: asset.Sha256,
+		})
+		if err != nil {
+			return err
+		}
+
+		bundledApp.Sha256, err = helpers.Sha256File(target)
+		if err != nil {
+			return err
+		}
+
+		if image := images[id]; image != "" {
+			bundledApp.Icon, err = fetchIcon(image, staging, appDir, config)
+			if err != nil {
+				logger.Warnf("Could not bundle the icon of %s, %s", id, err)
+			}
+		}
+
+		manifest.Apps = append(manifest.Apps, bundledApp)
+	}
+
+	manifestBytes, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+	err = os.WriteFile(filepath.Join(staging, manifestName), manifestBytes, 0644)
+	if err != nil {
+		return err
+	}
+
+	err = writeChecksums(staging)
+	if err != nil {
+		return err
+	}
+
+	logger.Debugf("Writing bundle to %s", options.Output)
+	return writeTar(staging, options.Output)
+}
+
+// selectAsset picks the asset built for goarch, preferring the
+// architecture recorded in the index over the file name
+func selectAsset(assets map[string]types.ZapDlAsset, goarch string) (types.ZapDlAsset, error) {
+	var names []string
+	candidates := map[string]types.ZapDlAsset{}
+	for _, asset := range assets {
+		matches := helpers.HasArchFor(asset.Name, goarch)
+		if asset.Arch != "" {
+			assetArch, err := helpers.NormalizeArch(asset.Arch)
+			matches = err == nil && assetArch == goarch
+		}
+		if matches {
+			names = append(names, asset.Name)
+			candidates[asset.Name] = asset
+		}
+	}
+	if len(names) == 0 {
+		return types.ZapDlAsset{}, fmt.Errorf("no AppImage found for %s", goarch)
+	}
+	sort.Strings(names)
+	return candidates[names[0]], nil
+}
+
+// fetchIcon downloads the icon listed in the index into appDir. Relative
+// icon paths are resolved against the mirrors
+func fetchIcon(image string, staging string, appDir string, config config.Store) (string, error) {
+	var iconBytes []byte
+	var err error
+	if strings.HasPrefix(image, "http://") || strings.HasPrefix(image, "https://") {
+		iconBytes, err = index.Fetch([]string{image}, func(mirror string) string {
+			return mirror
+		})
+	} else {
+		iconBytes, err = index.Fetch(config.MirrorRoot, func(mirror string) string {
+			return fmt.Sprintf("%s/%s", mirror, strings.TrimLeft(image, "/"))
+		})
+	}
+	if err != nil {
+		return "", err
+	}
+
+	ext := path.Ext(image)
+	if ext == "" {
+		ext = ".png"
+	}
+	icon := path.Join(appDir, "icon"+ext)
+	return icon, os.WriteFile(filepath.Join(staging, icon), iconBytes, 0644)
+}
+
+// writeChecksums writes the sha256 of every file in dir into SHA256SUMS,
+// in the format understood by sha256sum -c
+func writeChecksums(dir string) error {
+	var lines []string
+	err := filepath.Walk(dir, func(file string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() {
+			return err
+		}
+		rel, err := filepath.Rel(dir, file)
+		if err != nil {
+			return err
+		}
+		sum, err := helpers.Sha256File(file)
+		if err != nil {
+			return err
+		}
+		lines = append(lines, fmt.Sprintf("%s  %s\n", sum, filepath.ToSlash(rel)))
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(dir, checksumName), []byte(strings.Join(lines, "")), 0644)
+}
+
+func writeTar(dir string, target string) error {
+	f, err := os.Create(target)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	tw := tar.NewWriter(f)
+	err = filepath.Walk(dir, func(file string, info os.FileInfo, err error) error {
+		if err != nil || file == dir {
+			return err
+		}
+		rel, err := filepath.Rel(dir, file)
+		if err != nil {
+			return err
+		}
+
+		header, err := tar.FileInfoHeader(info, "")
+		if err != nil {
+			return err
+		}
+		header.Name = filepath.ToSlash(rel)
+		err = tw.WriteHeader(header)
+		if err != nil || info.IsDir() {
+			return err
+		}
+
+		src, err := os.Open(file)
+		if err != nil {
+			return err
+		}
+		defer src.Close()
+		_, err = io.Copy(tw, src)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	err = tw.Close()
+	if err != nil {
+		return err
+	}
+	return f.Close()
+}
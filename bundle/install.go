@@ -0,0 +1,239 @@
+package bundle
+
+import (
+	"archive/tar"
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"runtime"
+	"strings"
+
+	"github.com/srevinsaju/zap/appimage"
+	"github.com/srevinsaju/zap/config"
+	"github.com/srevinsaju/zap/index"
+	"github.com/srevinsaju/zap/internal/helpers"
+	"github.com/srevinsaju/zap/tui"
+	"github.com/srevinsaju/zap/types"
+)
+
+// InstallOptions configures Install
+type InstallOptions struct {
+	Silent bool
+
+	// Force installs a bundle which was created for another architecture
+	Force bool
+}
+
+// Install unpacks a bundle created by Create, verifies its checksums, and
+// installs every app in it, without accessing the network. The apps are
+// recorded as installed from the zap index, with the release and source
+// of their bundled index record, so that they can be updated once the
+// machine is online
+func Install(bundlePath string, options InstallOptions, config config.Store) error {
+	dir, err := os.MkdirTemp("", "zap-bundle")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(dir)
+
+	logger.Debugf("Unpacking %s into %s", bundlePath, dir)
+	err = unpackTar(bundlePath, dir)
+	if err != nil {
+		return err
+	}
+
+	manifestBytes, err := os.ReadFile(filepath.Join(dir, manifestName))
+	if err != nil {
+		return fmt.Errorf("%s is not a zap bundle, %s", bundlePath, err)
+	}
+	manifest := Manifest{}
+	err = json.Unmarshal(manifestBytes, &manifest)
+	if err != nil {
+		return err
+	}
+
+	if manifest.Arch != runtime.GOARCH && !options.Force {
+		return fmt.Errorf("bundle was created for %s, but this machine is %s", manifest.Arch, runtime.GOARCH)
+	}
+
+	err = verifyChecksums(dir)
+	if err != nil {
+		return err
+	}
+
+	for _, app := range manifest.Apps {
+		if app.Id == "" || app.Id != path.Base(app.Id) || app.Id == ".." {
+			return fmt.Errorf("invalid app %q in the bundle", app.Id)
+		}
+		fmt.Printf("%s[%s] Installing %s\n", tui.Blue("[bundle]"), tui.Yellow(app.Id), app.Tag)
+		file, err := bundleFile(dir, app.File)
+		if err != nil {
+			return err
+		}
+
+		sum, err := helpers.Sha256File(file)
+		if err != nil {
+			return err
+		}
+		if sum != app.Sha256 {
+			return fmt.Errorf("checksum mismatch for %s", app.File)
+		}
+
+		releases, asset, err := bundledRecord(dir, app)
+		if err != nil {
+			return err
+		}
+		if asset.Sha256 != "" && asset.Sha256 != sum {
+			return fmt.Errorf("%s does not match the checksum in the index record of %s", app.File, app.Id)
+		}
+		asset.Download = fmt.Sprintf("file://%s", file)
+		asset.Sha256 = sum
+
+		icon := ""
+		if app.Icon != "" {
+			icon, err = bundleFile(dir, app.Icon)
+			if err != nil {
+				return err
+			}
+		}
+
+		err = appimage.Install(types.InstallOptions{
+			Name:       app.Id,
+			Executable: app.Id,
+			Silent:     options.Silent,
+			Asset:      &asset,
+			Tag:        app.Tag,
+			Source:     &releases.Source,
+			Icon:       icon,
+		}, config)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// bundledRecord reads the index record of app from the bundle unpacked
+// into dir, and returns it, with the asset of app in the bundled release
+func bundledRecord(dir string, app BundledApp) (*types.ZapReleases, types.ZapDlAsset, error) {
+	file, err := bundleFile(dir, app.IndexFile)
+	if err != nil {
+		return nil, types.ZapDlAsset{}, err
+	}
+	coreBytes, err := os.ReadFile(file)
+	if err != nil {
+		return nil, types.ZapDlAsset{}, fmt.Errorf("the bundle has no index record for %s, %s", app.Id, err)
+	}
+	releases, err := index.ParseZapReleases(coreBytes)
+	if err != nil {
+		return nil, types.ZapDlAsset{}, fmt.Errorf("invalid index record for %s, %s", app.Id, err)
+	}
+	assets, err := releases.GetAssetsFromTag(app.Tag)
+	if err != nil {
+		return nil, types.ZapDlAsset{}, fmt.Errorf("the index record of %s has no release %s", app.Id, app.Tag)
+	}
+	for _, asset := range assets {
+		if asset.Name == app.Asset.Name {
+			return releases, asset, nil
+		}
+	}
+	return nil, types.ZapDlAsset{}, fmt.Errorf("the index record of %s has no asset %s in %s", app.Id, app.Asset.Name, app.Tag)
+}
+
+// bundleFile returns the path of the file at rel in the bundle unpacked
+// into dir. The paths in a bundle cannot be trusted, so rel must not
+// lead outside of dir
+func bundleFile(dir string, rel string) (string, error) {
+	dir = filepath.Clean(dir)
+	file := filepath.Join(dir, filepath.FromSlash(rel))
+	if filepath.IsAbs(filepath.FromSlash(rel)) || (file != dir && !strings.HasPrefix(file, dir+string(os.PathSeparator))) {
+		return "", fmt.Errorf("refusing to access %s outside of the bundle", rel)
+	}
+	return file, nil
+}
+
+// verifyChecksums checks every file listed in SHA256SUMS
+func verifyChecksums(dir string) error {
+	f, err := os.Open(filepath.Join(dir, checksumName))
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.SplitN(scanner.Text(), "  ", 2)
+		if len(fields) != 2 {
+			continue
+		}
+		logger.Debugf("Verifying %s", fields[1])
+		file, err := bundleFile(dir, fields[1])
+		if err != nil {
+			return err
+		}
+		sum, err := helpers.Sha256File(file)
+		if err != nil {
+			return err
+		}
+		if sum != fields[0] {
+			return fmt.Errorf("checksum mismatch for %s, the bundle is corrupt", fields[1])
+		}
+	}
+	return scanner.Err()
+}
+
+func unpackTar(bundlePath string, dir string) error {
+	f, err := os.Open(bundlePath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	tr := tar.NewReader(f)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+
+		target, err := bundleFile(dir, header.Name)
+		if err != nil {
+			return err
+		}
+
+		switch header.Typeflag {
+		case tar.TypeDir:
+			err = os.MkdirAll(target, 0755)
+		case tar.TypeReg:
+			err = unpackFile(tr, target, os.FileMode(header.Mode))
+		default:
+			logger.Debugf("Skipping %s of unsupported type in the bundle", header.Name)
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+func unpackFile(r io.Reader, target string, mode os.FileMode) error {
+	err := os.MkdirAll(filepath.Dir(target), 0755)
+	if err != nil {
+		return err
+	}
+	f, err := os.OpenFile(target, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, mode)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(f, r)
+	if err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
@@ -0,0 +1,128 @@
+package bundle
+
+import (
+	"archive/tar"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/srevinsaju/zap/types"
+)
+
+func TestBundleFile(t *testing.T) {
+	dir := "/tmp/zap-bundle"
+	tests := []struct {
+		rel     string
+		want    string
+		wantErr bool
+	}{
+		{rel: "manifest.json", want: "/tmp/zap-bundle/manifest.json"},
+		{rel: "apps/firefox/Firefox.AppImage", want: "/tmp/zap-bundle/apps/firefox/Firefox.AppImage"},
+		{rel: "./apps/../manifest.json", want: "/tmp/zap-bundle/manifest.json"},
+		{rel: "./", want: "/tmp/zap-bundle"},
+		{rel: "", want: "/tmp/zap-bundle"},
+		{rel: "../evil", wantErr: true},
+		{rel: "apps/../../evil", wantErr: true},
+		{rel: "/etc/passwd", wantErr: true},
+		{rel: "..", wantErr: true},
+		// shares the prefix of the bundle, but is outside of it
+		{rel: "../zap-bundle-evil/file", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := bundleFile(dir, tt.rel)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("bundleFile(%q) error = %v, wantErr %v", tt.rel, err, tt.wantErr)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("bundleFile(%q) = %s, want %s", tt.rel, got, tt.want)
+		}
+	}
+}
+
+func TestUnpackTarRejectsPathsOutsideOfTheBundle(t *testing.T) {
+	for _, name := range []string{"../evil", "/tmp/evil", "apps/../../evil"} {
+		tmp := t.TempDir()
+		bundlePath := filepath.Join(tmp, "bundle.tar")
+		f, err := os.Create(bundlePath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		tw := tar.NewWriter(f)
+		err = tw.WriteHeader(&tar.Header{Name: name, Mode: 0644, Size: 4, Typeflag: tar.TypeReg})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err = tw.Write([]byte("evil")); err != nil {
+			t.Fatal(err)
+		}
+		if err = tw.Close(); err != nil {
+			t.Fatal(err)
+		}
+		if err = f.Close(); err != nil {
+			t.Fatal(err)
+		}
+
+		dir := filepath.Join(tmp, "bundle")
+		if err = os.Mkdir(dir, 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err = unpackTar(bundlePath, dir); err == nil {
+			t.Errorf("unpacking %s did not fail", name)
+		}
+		if _, err = os.Stat(filepath.Join(tmp, "evil")); err == nil {
+			t.Errorf("unpacking %s wrote outside of the bundle", name)
+		}
+	}
+}
+
+func TestBundledRecord(t *testing.T) {
+	dir := t.TempDir()
+	err := os.MkdirAll(filepath.Join(dir, "apps", "foo"), 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+	core := `{
+		"owner": "someone",
+		"source": {"type": "github", "url": "https://github.com/someone/foo"},
+		"0": {"prerelease": false, "tag": "v2", "published_at": "2021-01-02", "assets": {
+			"0": {"name": "Foo-x86_64.AppImage", "download": "https://example.com/v2/Foo-x86_64.AppImage", "size": "1 MB", "sha256": "abc"}
+		}},
+		"1": {"prerelease": false, "tag": "v1", "published_at": "2021-01-01", "assets": {
+			"0": {"name": "Foo-x86_64.AppImage", "download": "https://example.com/v1/Foo-x86_64.AppImage", "size": "1 MB"}
+		}}
+	}`
+	err = os.WriteFile(filepath.Join(dir, "apps", "foo", "core.json"), []byte(core), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	app := BundledApp{
+		Id:        "foo",
+		Tag:       "v2",
+		Asset:     types.ZapDlAsset{Name: "Foo-x86_64.AppImage"},
+		IndexFile: "apps/foo/core.json",
+	}
+	releases, asset, err := bundledRecord(dir, app)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if releases.Source.Url != "https://github.com/someone/foo" {
+		t.Errorf("source is %s, want https://github.com/someone/foo", releases.Source.Url)
+	}
+	if asset.Download != "https://example.com/v2/Foo-x86_64.AppImage" || asset.Sha256 != "abc" {
+		t.Errorf("asset is %+v, want the one of v2", asset)
+	}
+
+	missing := []BundledApp{
+		{Id: "foo", Tag: "v3", Asset: app.Asset, IndexFile: app.IndexFile},
+		{Id: "foo", Tag: "v2", Asset: types.ZapDlAsset{Name: "Foo-aarch64.AppImage"}, IndexFile: app.IndexFile},
+		{Id: "foo", Tag: "v2", Asset: app.Asset, IndexFile: "apps/bar/core.json"},
+		{Id: "foo", Tag: "v2", Asset: app.Asset, IndexFile: "../core.json"},
+	}
+	for _, app := range missing {
+		if _, _, err := bundledRecord(dir, app); err == nil {
+			t.Errorf("bundledRecord(%+v) did not fail", app)
+		}
+	}
+}
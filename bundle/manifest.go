@@ -0,0 +1,37 @@
+package bundle
+
+import (
+	"github.com/srevinsaju/zap/logging"
+	"github.com/srevinsaju/zap/types"
+)
+
+var logger = logging.GetLogger()
+
+const (
+	manifestName = "manifest.json"
+	checksumName = "SHA256SUMS"
+)
+
+// Manifest describes the contents of a bundle, it is stored as
+// manifest.json at the root of the bundle
+type Manifest struct {
+	Version   int          `json:"version"`
+	Arch      string       `json:"arch"`
+	CreatedOn string       `json:"created_on"`
+	Apps      []BundledApp `json:"apps"`
+}
+
+// BundledApp is a single app in the bundle. All paths are relative to
+// the root of the bundle
+type BundledApp struct {
+	Id     string           `json:"id"`
+	Tag    string           `json:"tag"`
+	Asset  types.ZapDlAsset `json:"asset"`
+	File   string           `json:"file"`
+	Sha256 string           `json:"sha256"`
+
+	// IndexFile is the core.json of the app in the zap index,
+	// Icon is its icon in the index, if it has one
+	IndexFile string `json:"index_file"`
+	Icon      string `json:"icon,omitempty"`
+}
@@ -0,0 +1,262 @@
+package cache
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/srevinsaju/zap/config"
+	"github.com/srevinsaju/zap/internal/helpers"
+	"github.com/srevinsaju/zap/logging"
+)
+
+var logger = logging.GetLogger()
+
+// githubHosts are the hosts GitHub releases are downloaded from
+var githubHosts = []string{
+	"github.com",
+	"api.github.com",
+	"objects.githubusercontent.com",
+	"release-assets.githubusercontent.com",
+	"raw.githubusercontent.com",
+}
+
+// Cache is a content addressed store of downloaded files. Files are
+// stored by their sha256 under Root/sha256, and Root/url maps the
+// sha256 of each URL to the record of the file which was downloaded
+// from it
+type Cache struct {
+	Root string
+
+	// Proxy is the URL of another zap instance running zap cache serve,
+	// which is used as a pull-through proxy for downloads
+	Proxy string
+
+	// Hosts are the hosts which zap cache serve downloads from,
+	// for the other zap instances
+	Hosts []string
+}
+
+// urlRecord is what is known about the file downloaded from a URL. The
+// validators the server sent are used to check that the file has not
+// changed since
+type urlRecord struct {
+	Sha256       string `json:"sha256"`
+	ETag         string `json:"etag,omitempty"`
+	LastModified string `json:"last_modified,omitempty"`
+}
+
+// New creates a Cache from the CacheStore and CacheProxy configuration.
+// The hosts of the mirrors, and GitHub, are allowed to be downloaded from
+func New(config config.Store) *Cache {
+	hosts := append([]string{}, githubHosts...)
+	for _, mirror := range append(config.Mirror, config.MirrorRoot...) {
+		u, err := url.Parse(mirror)
+		if err == nil && u.Hostname() != "" {
+			hosts = append(hosts, u.Hostname())
+		}
+	}
+	return &Cache{
+		Root:  config.CacheStore,
+		Proxy: config.CacheProxy,
+		Hosts: hosts,
+	}
+}
+
+func hashString(s string) string {
+	sum := sha256.Sum256([]byte(s))
+	return hex.EncodeToString(sum[:])
+}
+
+func isSha256(s string) bool {
+	if len(s) != sha256.Size*2 {
+		return false
+	}
+	_, err := hex.DecodeString(s)
+	return err == nil
+}
+
+func (c *Cache) contentPath(sum string) string {
+	return filepath.Join(c.Root, "sha256", strings.ToLower(sum))
+}
+
+func (c *Cache) urlPath(url string) string {
+	return filepath.Join(c.Root, "url", hashString(url))
+}
+
+// Lookup returns the path of the cached file for url. If sum, the
+// expected sha256 of the file, is known, the file is looked up by its
+// content, so that the same file is found even if it was downloaded
+// from another URL. Otherwise, the server is asked if the file downloaded
+// from url before has changed, and it is only used if it has not
+func (c *Cache) Lookup(url string, sum string) (string, bool) {
+	if sum == "" {
+		record, err := c.loadRecord(url)
+		if err != nil || !c.revalidate(url, record) {
+			return "", false
+		}
+		sum = record.Sha256
+	}
+	if !isSha256(sum) {
+		return "", false
+	}
+
+	cached := c.contentPath(sum)
+	if !helpers.CheckIfFileExists(cached) {
+		return "", false
+	}
+	logger.Debugf("Found %s in cache as %s", url, cached)
+	return cached, true
+}
+
+func (c *Cache) loadRecord(url string) (urlRecord, error) {
+	record := urlRecord{}
+	data, err := os.ReadFile(c.urlPath(url))
+	if err != nil {
+		return record, err
+	}
+	err = json.Unmarshal(data, &record)
+	return record, err
+}
+
+// revalidate returns true if the server responds that the file at url
+// has not changed since the record was made
+func (c *Cache) revalidate(url string, record urlRecord) bool {
+	if record.ETag == "" && record.LastModified == "" {
+		return false
+	}
+	req, err := http.NewRequest(http.MethodHead, url, nil)
+	if err != nil {
+		return false
+	}
+	if record.ETag != "" {
+		req.Header.Set("If-None-Match", record.ETag)
+	}
+	if record.LastModified != "" {
+		req.Header.Set("If-Modified-Since", record.LastModified)
+	}
+	resp, err := helpers.HTTPClient().Do(req)
+	if err != nil {
+		logger.Debugf("Failed to revalidate %s, %s", url, err)
+		return false
+	}
+	resp.Body.Close()
+	logger.Debugf("Revalidated %s, %s", url, resp.Status)
+	return resp.StatusCode == http.StatusNotModified
+}
+
+// Add stores file in the cache as downloaded from url, and returns its
+// sha256. header is the response header of the server, if url was
+// downloaded from it, or nil
+func (c *Cache) Add(url string, file string, header http.Header) (string, error) {
+	sum, err := helpers.Sha256File(file)
+	if err != nil {
+		return "", err
+	}
+
+	cached := c.contentPath(sum)
+	if !helpers.CheckIfFileExists(cached) {
+		err = os.MkdirAll(filepath.Dir(cached), 0755)
+		if err != nil {
+			return "", err
+		}
+
+		// copy into a temporary file first, so that an interrupted copy
+		// is never mistaken for a cached file
+		tmp, err := os.CreateTemp(filepath.Dir(cached), "tmp")
+		if err != nil {
+			return "", err
+		}
+		err = copyInto(tmp, file)
+		if err != nil {
+			_ = os.Remove(tmp.Name())
+			return "", err
+		}
+		err = os.Rename(tmp.Name(), cached)
+		if err != nil {
+			_ = os.Remove(tmp.Name())
+			return "", err
+		}
+	}
+
+	if url != "" {
+		err = os.MkdirAll(filepath.Dir(c.urlPath(url)), 0755)
+		if err != nil {
+			return "", err
+		}
+		record := urlRecord{Sha256: sum}
+		if header != nil {
+			record.ETag = header.Get("ETag")
+			record.LastModified = header.Get("Last-Modified")
+		}
+		data, err := json.Marshal(record)
+		if err != nil {
+			return "", err
+		}
+		err = os.WriteFile(c.urlPath(url), data, 0644)
+		if err != nil {
+			return "", err
+		}
+	}
+	logger.Debugf("Added %s to cache as %s", url, cached)
+	return sum, nil
+}
+
+func copyInto(dst *os.File, file string) error {
+	src, err := os.Open(file)
+	if err != nil {
+		dst.Close()
+		return err
+	}
+	defer src.Close()
+
+	_, err = io.Copy(dst, src)
+	if err != nil {
+		dst.Close()
+		return err
+	}
+	return dst.Close()
+}
+
+// Size returns the number of files, and the total size of the cache in bytes
+func (c *Cache) Size() (int, int64, error) {
+	count := 0
+	var size int64
+	err := filepath.Walk(filepath.Join(c.Root, "sha256"), func(path string, info os.FileInfo, err error) error {
+		if os.IsNotExist(err) {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		if !info.IsDir() {
+			count += 1
+			size += info.Size()
+		}
+		return nil
+	})
+	return count, size, err
+}
+
+// Clean removes every file from the cache, and returns the number of
+// bytes which were freed
+func (c *Cache) Clean() (int64, error) {
+	_, size, err := c.Size()
+	if err != nil {
+		return 0, err
+	}
+	err = os.RemoveAll(filepath.Join(c.Root, "sha256"))
+	if err != nil {
+		return 0, err
+	}
+	err = os.RemoveAll(filepath.Join(c.Root, "url"))
+	if err != nil {
+		return 0, err
+	}
+	return size, nil
+}
@@ -0,0 +1,62 @@
+package cache
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLookup(t *testing.T) {
+	modified := false
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !modified && r.Header.Get("If-None-Match") == `"v1"` {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("ETag", `"v2"`)
+		fmt.Fprint(w, "v2")
+	}))
+	defer server.Close()
+
+	c := &Cache{Root: t.TempDir()}
+	file := filepath.Join(t.TempDir(), "Foo.AppImage")
+	if err := os.WriteFile(file, []byte("v1"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	target := server.URL + "/Foo.AppImage"
+	sum, err := c.Add(target, file, http.Header{"Etag": []string{`"v1"`}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sum != sha256Hex("v1") {
+		t.Fatalf("sha256 = %s, want %s", sum, sha256Hex("v1"))
+	}
+
+	tests := []struct {
+		name     string
+		target   string
+		sum      string
+		modified bool
+		want     bool
+	}{
+		{name: "by content", target: "https://example.com/other", sum: sha256Hex("v1"), want: true},
+		{name: "by content, not cached", target: target, sum: sha256Hex("v2"), want: false},
+		{name: "not a sha256", target: target, sum: "../../etc/passwd", want: false},
+		{name: "by url, not modified", target: target, want: true},
+		{name: "by url, modified", target: target, modified: true, want: false},
+		{name: "by url, never downloaded", target: server.URL + "/Bar.AppImage", want: false},
+	}
+	for _, tt := range tests {
+		modified = tt.modified
+		cached, ok := c.Lookup(tt.target, tt.sum)
+		if ok != tt.want {
+			t.Errorf("%s: Lookup() = %v, want %v", tt.name, ok, tt.want)
+		}
+		if ok && cached != c.contentPath(sha256Hex("v1")) {
+			t.Errorf("%s: Lookup() = %s, want %s", tt.name, cached, c.contentPath(sha256Hex("v1")))
+		}
+	}
+}
@@ -0,0 +1,127 @@
+package cache
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/srevinsaju/zap/internal/helpers"
+)
+
+// ProxyURL returns the URL at which the proxy serves url, through the
+// pull-through endpoint of Handler
+func (c *Cache) ProxyURL(target string, sum string) string {
+	query := url.Values{}
+	query.Set("url", target)
+	if sum != "" {
+		query.Set("sha256", sum)
+	}
+	return fmt.Sprintf("%s/fetch?%s", strings.TrimRight(c.Proxy, "/"), query.Encode())
+}
+
+// Handler serves the cache over HTTP, so that other zap instances can use
+// it as their CacheProxy.
+//
+//	GET /sha256/<sha256>               serves a cached file by its content
+//	GET /fetch?url=<url>[&sha256=...]  serves a cached file, downloading it first if needed
+func (c *Cache) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/sha256/", func(w http.ResponseWriter, r *http.Request) {
+		sum := path.Base(r.URL.Path)
+		cached, ok := c.Lookup("", sum)
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		http.ServeFile(w, r, cached)
+	})
+	mux.HandleFunc("/fetch", func(w http.ResponseWriter, r *http.Request) {
+		target := r.URL.Query().Get("url")
+		sum := r.URL.Query().Get("sha256")
+		if !strings.HasPrefix(target, "http://") && !strings.HasPrefix(target, "https://") {
+			http.Error(w, "url must be a http or https url", http.StatusBadRequest)
+			return
+		}
+		if !c.allowed(target) {
+			http.Error(w, "downloading from this host is not allowed", http.StatusForbidden)
+			return
+		}
+
+		cached, ok := c.Lookup(target, sum)
+		if !ok {
+			logger.Infof("Fetching %s", target)
+			var err error
+			cached, err = c.fetch(target, sum)
+			if err != nil {
+				logger.Warnf("Failed to fetch %s, %s", target, err)
+				http.Error(w, err.Error(), http.StatusBadGateway)
+				return
+			}
+		}
+		logger.Infof("Serving %s", target)
+		http.ServeFile(w, r, cached)
+	})
+	return mux
+}
+
+// allowed returns true if target is on one of Hosts, so that the
+// server cannot be used to reach anything else
+func (c *Cache) allowed(target string) bool {
+	u, err := url.Parse(target)
+	if err != nil {
+		return false
+	}
+	for _, host := range c.Hosts {
+		if strings.EqualFold(u.Hostname(), host) {
+			return true
+		}
+	}
+	return false
+}
+
+// fetch downloads target into the cache, and returns the path of the
+// cached file
+func (c *Cache) fetch(target string, sum string) (string, error) {
+	resp, err := helpers.HTTPClient().Get(target)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("upstream responded with %s", resp.Status)
+	}
+
+	err = os.MkdirAll(c.Root, 0755)
+	if err != nil {
+		return "", err
+	}
+	tmp, err := os.CreateTemp(c.Root, "download")
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(tmp.Name())
+
+	_, err = io.Copy(tmp, resp.Body)
+	if err != nil {
+		tmp.Close()
+		return "", err
+	}
+	err = tmp.Close()
+	if err != nil {
+		return "", err
+	}
+
+	downloadedSum, err := c.Add(target, tmp.Name(), resp.Header)
+	if err != nil {
+		return "", err
+	}
+	if sum != "" && !strings.EqualFold(sum, downloadedSum) {
+		return "", errors.New("checksum mismatch")
+	}
+	return c.contentPath(downloadedSum), nil
+}
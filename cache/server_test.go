@@ -0,0 +1,123 @@
+package cache
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+)
+
+func sha256Hex(s string) string {
+	sum := sha256.Sum256([]byte(s))
+	return hex.EncodeToString(sum[:])
+}
+
+// upstreamServer serves the path of each request as its content, and
+// counts the requests
+func upstreamServer(t *testing.T) (*httptest.Server, *int) {
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		fmt.Fprintf(w, "content of %s", r.URL.Path)
+	}))
+	t.Cleanup(server.Close)
+	return server, &requests
+}
+
+func TestAllowed(t *testing.T) {
+	c := &Cache{Hosts: []string{"github.com", "mirror.example.com"}}
+	tests := []struct {
+		target string
+		want   bool
+	}{
+		{target: "https://github.com/foo/bar/releases/download/v1/Foo.AppImage", want: true},
+		{target: "https://GitHub.com/foo", want: true},
+		{target: "http://mirror.example.com:8080/foo", want: true},
+		{target: "https://github.com.evil.com/foo", want: false},
+		{target: "https://evil.com/github.com", want: false},
+		{target: "https://github.com@evil.com/foo", want: false},
+		{target: "http://127.0.0.1/foo", want: false},
+		{target: "http://[::1", want: false},
+	}
+	for _, tt := range tests {
+		if got := c.allowed(tt.target); got != tt.want {
+			t.Errorf("allowed(%q) = %v, want %v", tt.target, got, tt.want)
+		}
+	}
+}
+
+func TestFetchHandler(t *testing.T) {
+	upstream, requests := upstreamServer(t)
+	u, err := url.Parse(upstream.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := &Cache{Root: t.TempDir(), Hosts: []string{u.Hostname()}}
+	proxy := httptest.NewServer(c.Handler())
+	defer proxy.Close()
+	c.Proxy = proxy.URL
+
+	get := func(target string, sum string) (int, string) {
+		resp, err := http.Get(c.ProxyURL(target, sum))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		body, err := io.ReadAll(resp.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return resp.StatusCode, string(body)
+	}
+
+	foo := upstream.URL + "/Foo.AppImage"
+	tests := []struct {
+		name       string
+		target     string
+		sum        string
+		wantStatus int
+		wantBody   string
+	}{
+		{name: "not http", target: "file:///etc/passwd", wantStatus: http.StatusBadRequest},
+		{name: "host not allowed", target: "http://localhost.localdomain/Foo.AppImage", wantStatus: http.StatusForbidden},
+		{name: "checksum mismatch", target: foo, sum: sha256Hex("something else"), wantStatus: http.StatusBadGateway},
+		{name: "checksum matches", target: foo, sum: sha256Hex("content of /Foo.AppImage"),
+			wantStatus: http.StatusOK, wantBody: "content of /Foo.AppImage"},
+		{name: "without checksum", target: upstream.URL + "/Bar.AppImage",
+			wantStatus: http.StatusOK, wantBody: "content of /Bar.AppImage"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			status, body := get(tt.target, tt.sum)
+			if status != tt.wantStatus {
+				t.Fatalf("status = %d, want %d", status, tt.wantStatus)
+			}
+			if tt.wantBody != "" && body != tt.wantBody {
+				t.Errorf("body = %q, want %q", body, tt.wantBody)
+			}
+		})
+	}
+
+	// files which are cached by their content are not downloaded again
+	before := *requests
+	status, body := get(foo, sha256Hex("content of /Foo.AppImage"))
+	if status != http.StatusOK || body != "content of /Foo.AppImage" {
+		t.Errorf("cached file = %d %q", status, body)
+	}
+	if *requests != before {
+		t.Errorf("upstream was requested %d times for a cached file", *requests-before)
+	}
+
+	resp, err := http.Get(proxy.URL + "/sha256/" + sha256Hex("content of /Foo.AppImage"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("status of the file by its sha256 = %d, want %d", resp.StatusCode, http.StatusOK)
+	}
+}
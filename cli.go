@@ -1,22 +1,30 @@
 package main
 
 import (
+	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
 	"net/http"
 	"os"
+	"path/filepath"
 	"runtime"
 	"strings"
 
 	"github.com/AlecAivazis/survey/v2"
 
 	"github.com/srevinsaju/zap/appimage"
+	"github.com/srevinsaju/zap/bundle"
+	"github.com/srevinsaju/zap/cache"
 	"github.com/srevinsaju/zap/config"
 	"github.com/srevinsaju/zap/daemon"
+	"github.com/srevinsaju/zap/exceptions"
+	"github.com/srevinsaju/zap/index"
+	"github.com/srevinsaju/zap/index/builder"
 	"github.com/srevinsaju/zap/internal/helpers"
 	"github.com/srevinsaju/zap/search"
 	"github.com/srevinsaju/zap/tui"
+	"github.com/srevinsaju/zap/types"
 	"github.com/urfave/cli/v2"
 )
 
@@ -94,6 +102,314 @@ func removeAppImageCliContextWrapper(context *cli.Context) error {
 	return err
 }
 
+func defaultCliContextWrapper(context *cli.Context) error {
+	appName := context.Args().First()
+	if appName == "" {
+		fmt.Printf("%s missing\n", tui.Green("appname"))
+		return nil
+	}
+	if context.Args().Len() < 2 {
+		fmt.Printf("%s missing\n", tui.Green("mimetype or scheme"))
+		return nil
+	}
+
+	zapConfigPath := config.GetPath()
+
+	zapConfig, err := config.NewZapConfig(zapConfigPath)
+	if err != nil {
+		return err
+	}
+
+	return appimage.SetDefault(appName, context.Args().Tail(), *zapConfig)
+}
+
+func adoptCliContextWrapper(context *cli.Context) error {
+	if context.Args().Len() == 0 {
+		fmt.Printf("%s missing\n", tui.Green("path"))
+		return nil
+	}
+
+	zapConfigPath := config.GetPath()
+
+	zapConfig, err := config.NewZapConfig(zapConfigPath)
+	if err != nil {
+		return err
+	}
+
+	options := types.AdoptOptions{
+		Executable:         context.String("executable"),
+		Move:               context.Bool("move"),
+		ExecutableConflict: context.String("executable-conflict"),
+	}
+	for _, file := range context.Args().Slice() {
+		if info, statErr := os.Stat(file); statErr == nil && info.IsDir() {
+			err = appimage.AdoptDir(file, options, *zapConfig)
+		} else {
+			err = appimage.Adopt(file, options, *zapConfig)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func importCliContextWrapper(context *cli.Context) error {
+	from := context.String("from")
+	if from == "" {
+		fmt.Printf("%s missing\n", tui.Green("--from"))
+		return nil
+	}
+
+	zapConfigPath := config.GetPath()
+
+	zapConfig, err := config.NewZapConfig(zapConfigPath)
+	if err != nil {
+		return err
+	}
+	return appimage.Import(from, context.Bool("unintegrate"), *zapConfig)
+}
+
+func integrateCliContextWrapper(context *cli.Context) error {
+	appName := context.Args().First()
+	if appName == "" && !context.Bool("all") {
+		fmt.Printf("%s missing\n", tui.Green("appname"))
+		return nil
+	}
+
+	zapConfigPath := config.GetPath()
+
+	zapConfig, err := config.NewZapConfig(zapConfigPath)
+	if err != nil {
+		return err
+	}
+
+	if context.Bool("all") {
+		return appimage.IntegrateAll(*zapConfig)
+	}
+	return appimage.Integrate(appName, *zapConfig)
+}
+
+func unintegrateCliContextWrapper(context *cli.Context) error {
+	appName := context.Args().First()
+	if appName == "" && !context.Bool("all") {
+		fmt.Printf("%s missing\n", tui.Green("appname"))
+		return nil
+	}
+
+	zapConfigPath := config.GetPath()
+
+	zapConfig, err := config.NewZapConfig(zapConfigPath)
+	if err != nil {
+		return err
+	}
+
+	if context.Bool("all") {
+		return appimage.UnintegrateAll(*zapConfig)
+	}
+	return appimage.Unintegrate(appName, *zapConfig)
+}
+
+// checkApps runs check on the apps given as arguments, or on every
+// installed app, and returns an error if any of them is broken
+func checkApps(context *cli.Context, check func(executable string, config config.Store) (bool, error)) error {
+	zapConfigPath := config.GetPath()
+
+	zapConfig, err := config.NewZapConfig(zapConfigPath)
+	if err != nil {
+		return err
+	}
+
+	apps := context.Args().Slice()
+	if len(apps) == 0 {
+		apps, err = appimage.List(*zapConfig, false)
+		if err != nil {
+			return err
+		}
+	}
+
+	broken := 0
+	for _, executable := range apps {
+		ok, err := check(executable, *zapConfig)
+		if err == exceptions.NotInstalledError {
+			fmt.Printf("%s is not installed\n", tui.Yellow(executable))
+			continue
+		} else if err != nil {
+			return err
+		}
+		if !ok {
+			broken++
+		}
+	}
+	if broken > 0 {
+		return fmt.Errorf("%d apps are broken", broken)
+	}
+	return nil
+}
+
+func verifyCliContextWrapper(context *cli.Context) error {
+	return checkApps(context, appimage.Verify)
+}
+
+func repairCliContextWrapper(context *cli.Context) error {
+	return checkApps(context, appimage.Repair)
+}
+
+func autostartEnableCliContextWrapper(context *cli.Context) error {
+	appName := context.Args().First()
+	if appName == "" {
+		fmt.Printf("%s missing\n", tui.Green("appname"))
+		return nil
+	}
+
+	zapConfigPath := config.GetPath()
+
+	zapConfig, err := config.NewZapConfig(zapConfigPath)
+	if err != nil {
+		return err
+	}
+
+	return appimage.EnableAutostart(appName, *zapConfig)
+}
+
+func autostartDisableCliContextWrapper(context *cli.Context) error {
+	appName := context.Args().First()
+	if appName == "" {
+		fmt.Printf("%s missing\n", tui.Green("appname"))
+		return nil
+	}
+
+	zapConfigPath := config.GetPath()
+
+	zapConfig, err := config.NewZapConfig(zapConfigPath)
+	if err != nil {
+		return err
+	}
+
+	return appimage.DisableAutostart(appName, *zapConfig)
+}
+
+func launchSetCliContextWrapper(context *cli.Context) error {
+	appName := context.Args().First()
+	if appName == "" {
+		fmt.Printf("%s missing\n", tui.Green("appname"))
+		return nil
+	}
+
+	zapConfigPath := config.GetPath()
+
+	zapConfig, err := config.NewZapConfig(zapConfigPath)
+	if err != nil {
+		return err
+	}
+
+	workingDir := context.String("working-dir")
+	if workingDir != "" {
+		workingDir, err = filepath.Abs(workingDir)
+		if err != nil {
+			return err
+		}
+	}
+
+	launch := appimage.LaunchConfig{
+		Args:       repeatedStrings(context, "arg"),
+		Env:        repeatedStrings(context, "env"),
+		WorkingDir: workingDir,
+	}
+	return appimage.SetLaunchConfig(appName, launch, *zapConfig)
+}
+
+func launchShowCliContextWrapper(context *cli.Context) error {
+	appName := context.Args().First()
+	if appName == "" {
+		fmt.Printf("%s missing\n", tui.Green("appname"))
+		return nil
+	}
+
+	zapConfigPath := config.GetPath()
+
+	zapConfig, err := config.NewZapConfig(zapConfigPath)
+	if err != nil {
+		return err
+	}
+
+	return appimage.ShowLaunchConfig(appName, *zapConfig)
+}
+
+func launchResetCliContextWrapper(context *cli.Context) error {
+	appName := context.Args().First()
+	if appName == "" {
+		fmt.Printf("%s missing\n", tui.Green("appname"))
+		return nil
+	}
+
+	zapConfigPath := config.GetPath()
+
+	zapConfig, err := config.NewZapConfig(zapConfigPath)
+	if err != nil {
+		return err
+	}
+
+	return appimage.SetLaunchConfig(appName, appimage.LaunchConfig{}, *zapConfig)
+}
+
+func runCliContextWrapper(context *cli.Context) error {
+	appName := context.Args().First()
+	if appName == "" {
+		fmt.Printf("%s missing\n", tui.Green("appname"))
+		return nil
+	}
+
+	// the arguments for the app follow --
+	args := context.Args().Tail()
+	if len(args) > 0 && args[0] == "--" {
+		args = args[1:]
+	}
+
+	zapConfigPath := config.GetPath()
+
+	zapConfig, err := config.NewZapConfig(zapConfigPath)
+	if err != nil {
+		return err
+	}
+
+	return appimage.Run(appName, args, *zapConfig)
+}
+
+func sandboxSetCliContextWrapper(context *cli.Context) error {
+	appName := context.Args().First()
+	if appName == "" {
+		fmt.Printf("%s missing\n", tui.Green("appname"))
+		return nil
+	}
+
+	zapConfigPath := config.GetPath()
+
+	zapConfig, err := config.NewZapConfig(zapConfigPath)
+	if err != nil {
+		return err
+	}
+
+	return appimage.SetSandbox(appName, context.String("profile"), *zapConfig)
+}
+
+func portableEnableCliContextWrapper(context *cli.Context) error {
+	appName := context.Args().First()
+	if appName == "" {
+		fmt.Printf("%s missing\n", tui.Green("appname"))
+		return nil
+	}
+
+	zapConfigPath := config.GetPath()
+
+	zapConfig, err := config.NewZapConfig(zapConfigPath)
+	if err != nil {
+		return err
+	}
+
+	return appimage.EnablePortable(appName, *zapConfig)
+}
+
 func listAppImageCliContextWrapper(context *cli.Context) error {
 	formatter := "- %s\n"
 	if context.Bool("no-color") {
@@ -107,6 +423,25 @@ func listAppImageCliContextWrapper(context *cli.Context) error {
 		return err
 	}
 
+	if context.String("unused") != "" {
+		unusedFor, err := helpers.ParseDuration(context.String("unused"))
+		if err != nil {
+			return err
+		}
+		apps, err := appimage.ListUnused(*zapConfig, unusedFor)
+		if err != nil {
+			return err
+		}
+		for _, app := range apps {
+			if context.Bool("no-color") {
+				fmt.Printf("%s (%s)\n", app.Executable, app.UsageSummary())
+				continue
+			}
+			fmt.Printf("- %s (%s)\n", tui.Yellow(app.Executable), app.UsageSummary())
+		}
+		return nil
+	}
+
 	apps, err := appimage.List(*zapConfig, context.Bool("index"))
 	if err != nil {
 		return err
@@ -129,11 +464,184 @@ func searchAppImagesCliContextWrapper(c *cli.Context) error {
 		return err
 	}
 
-	mirror := zapConfig.MirrorRoot
-	err = search.WithCli(mirror)
+	mirrors := zapConfig.MirrorRoot
+	err = search.WithCli(mirrors)
 	return err
 }
 
+func indexBuildCliContextWrapper(context *cli.Context) error {
+	source := context.Args().First()
+	if source == "" {
+		fmt.Printf("%s missing\n", tui.Green("directory or apps.yaml"))
+		return nil
+	}
+
+	options := builder.Options{
+		Output:     context.String("output"),
+		BaseURL:    context.String("base-url"),
+		Maintainer: context.String("maintainer"),
+	}
+
+	info, err := os.Stat(source)
+	if err != nil {
+		return err
+	}
+	if info.IsDir() {
+		err = builder.FromDirectory(source, options)
+	} else {
+		err = builder.FromDescription(source, options)
+	}
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("⚡️ Index written to %s\n", tui.Green(options.Output))
+	return nil
+}
+
+func indexMirrorCliContextWrapper(context *cli.Context) error {
+	dir := context.Args().First()
+	if dir == "" {
+		fmt.Printf("%s missing\n", tui.Green("directory"))
+		return nil
+	}
+
+	zapConfigPath := config.GetPath()
+	zapConfig, err := config.NewZapConfig(zapConfigPath)
+	if err != nil {
+		return err
+	}
+
+	err = index.Replicate(dir, index.ReplicateOptions{
+		Apps:       context.StringSlice("apps"),
+		WithAssets: context.Bool("with-assets"),
+		LatestOnly: context.Bool("latest"),
+		BaseURL:    context.String("base-url"),
+	}, *zapConfig)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("⚡️ Index replicated to %s\n", tui.Green(dir))
+	return nil
+}
+
+func indexServeCliContextWrapper(context *cli.Context) error {
+	dir := context.Args().First()
+	if dir == "" {
+		fmt.Printf("%s missing\n", tui.Green("directory"))
+		return nil
+	}
+
+	listen := context.String("listen")
+	fmt.Printf("Serving %s on %s\n", tui.Green(dir), tui.Yellow(fmt.Sprintf("http://%s", listen)))
+	return http.ListenAndServe(listen, http.FileServer(http.Dir(dir)))
+}
+
+func bundleCreateCliContextWrapper(context *cli.Context) error {
+	zapConfigPath := config.GetPath()
+	zapConfig, err := config.NewZapConfig(zapConfigPath)
+	if err != nil {
+		return err
+	}
+
+	options := bundle.CreateOptions{
+		Apps:   context.StringSlice("apps"),
+		Output: context.String("output"),
+		Arch:   context.String("arch"),
+	}
+	err = bundle.Create(options, *zapConfig)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("📦 Bundle saved as %s\n", tui.Green(options.Output))
+	return nil
+}
+
+func bundleInstallCliContextWrapper(context *cli.Context) error {
+	bundlePath := context.Args().First()
+	if bundlePath == "" {
+		fmt.Printf("%s missing\n", tui.Green("bundle"))
+		return nil
+	}
+
+	zapConfigPath := config.GetPath()
+	zapConfig, err := config.NewZapConfig(zapConfigPath)
+	if err != nil {
+		return err
+	}
+
+	return bundle.Install(bundlePath, bundle.InstallOptions{
+		Silent: context.Bool("silent"),
+		Force:  context.Bool("force"),
+	}, *zapConfig)
+}
+
+func cacheServeCliContextWrapper(context *cli.Context) error {
+	zapConfigPath := config.GetPath()
+	zapConfig, err := config.NewZapConfig(zapConfigPath)
+	if err != nil {
+		return err
+	}
+
+	c := cache.New(*zapConfig)
+	c.Hosts = append(c.Hosts, context.StringSlice("allow-host")...)
+
+	listen := context.String("listen")
+	fmt.Printf("Serving %s on %s\n", tui.Green(zapConfig.CacheStore), tui.Yellow(fmt.Sprintf("http://%s", listen)))
+	return http.ListenAndServe(listen, c.Handler())
+}
+
+func cacheSizeCliContextWrapper(_ *cli.Context) error {
+	zapConfigPath := config.GetPath()
+	zapConfig, err := config.NewZapConfig(zapConfigPath)
+	if err != nil {
+		return err
+	}
+
+	count, size, err := cache.New(*zapConfig).Size()
+	if err != nil {
+		return err
+	}
+	fmt.Printf("%d files, %s in %s\n", count, tui.Yellow(tui.HumanizeBytes(size)), zapConfig.CacheStore)
+	return nil
+}
+
+func cacheCleanCliContextWrapper(_ *cli.Context) error {
+	zapConfigPath := config.GetPath()
+	zapConfig, err := config.NewZapConfig(zapConfigPath)
+	if err != nil {
+		return err
+	}
+
+	size, err := cache.New(*zapConfig).Clean()
+	if err != nil {
+		return err
+	}
+	fmt.Printf("🧹 Freed %s\n", tui.Green(tui.HumanizeBytes(size)))
+	return nil
+}
+
+func gcCliContextWrapper(context *cli.Context) error {
+	zapConfigPath := config.GetPath()
+	zapConfig, err := config.NewZapConfig(zapConfigPath)
+	if err != nil {
+		return err
+	}
+
+	size, err := appimage.GC(*zapConfig, context.Bool("dry-run"))
+	if err != nil {
+		return err
+	}
+	if context.Bool("dry-run") {
+		fmt.Printf("🧹 Would free %s\n", tui.Green(tui.HumanizeBytes(size)))
+		return nil
+	}
+	fmt.Printf("🧹 Freed %s\n", tui.Green(tui.HumanizeBytes(size)))
+	return nil
+}
+
 func upgradeAppImageCliContextWrapper(_ *cli.Context) error {
 
 	zapConfigPath := config.GetPath()
@@ -160,6 +668,44 @@ func configCliContextWrapper(_ *cli.Context) error {
 
 }
 
+func doctorCliContextWrapper(context *cli.Context) error {
+	checks := appimage.Doctor(config.GetPath())
+
+	failed := 0
+	for _, check := range checks {
+		if check.Status == appimage.DoctorError {
+			failed++
+		}
+	}
+
+	if context.Bool("json") {
+		checksJson, err := json.MarshalIndent(checks, "", "  ")
+		if err != nil {
+			return err
+		}
+		fmt.Println(string(checksJson))
+	} else {
+		for _, check := range checks {
+			switch check.Status {
+			case appimage.DoctorOK:
+				fmt.Printf("%s %s: %s\n", tui.Green("✔"), check.Name, check.Message)
+			case appimage.DoctorWarning:
+				fmt.Printf("%s %s: %s\n", tui.Yellow("!"), check.Name, check.Message)
+			default:
+				fmt.Printf("%s %s: %s\n", tui.Red("✘"), check.Name, check.Message)
+			}
+			if check.Status != appimage.DoctorOK && check.Remedy != "" {
+				fmt.Printf("  %s\n", tui.Blue(check.Remedy))
+			}
+		}
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("%d checks failed", failed)
+	}
+	return nil
+}
+
 func daemonCliContextWrapper(context *cli.Context) error {
 
 	if context.Bool("install") {
@@ -173,6 +719,18 @@ func daemonCliContextWrapper(context *cli.Context) error {
 		return err
 	}
 
+	watchDirs := append(zapConfig.WatchDirs, repeatedStrings(context, "watch")...)
+	if len(watchDirs) > 0 {
+		err = daemon.Watch(watchDirs, func(file string) error {
+			return appimage.WatchCreated(file, *zapConfig)
+		}, func(file string) error {
+			return appimage.WatchRemoved(file, *zapConfig)
+		})
+		if err != nil {
+			return err
+		}
+	}
+
 	daemon.Sync(func() ([]string, error) {
 		return appimage.Upgrade(*zapConfig, true)
 	})
@@ -190,7 +748,7 @@ func selfUpdateCliContextWrapper(c *cli.Context) error {
 	}
 
 	updateCheckUrl := fmt.Sprintf("%s/zap-release-metadata", DefaultUpdateUrlPrefix)
-	r, err := http.Get(updateCheckUrl)
+	r, err := helpers.HTTPClient().Get(updateCheckUrl)
 	if err != nil {
 		fmt.Println("Failed to check for updates.")
 		return err
@@ -232,7 +790,7 @@ func selfUpdateCliContextWrapper(c *cli.Context) error {
 		return err
 	}
 
-	err = tui.DownloadFileWithProgressBar(updateUrl, tempDestination, "zap")
+	err = tui.DownloadFileWithProgressBar(updateUrl, tempDestination, "zap", tui.DownloadOptions{})
 	if err != nil {
 		return err
 	}
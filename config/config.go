@@ -5,6 +5,8 @@ import (
 	"os"
 	"path/filepath"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/AlecAivazis/survey/v2"
 	"github.com/srevinsaju/zap/daemon"
@@ -16,14 +18,54 @@ import (
 
 type Store struct {
 	Version          int
-	Mirror           string
-	MirrorRoot       string
+	Mirror           []string
+	MirrorRoot       []string
 	LocalStore       string
 	IconStore        string
 	IndexStore       string
 	ApplicationStore string
+	CacheStore       string
+	CacheProxy       string
 	CustomIconTheme  bool
 	Integrate        string
+
+	// UseXdgDesktopMenu installs desktop files with xdg-desktop-menu
+	// instead of zap's own desktop integration
+	UseXdgDesktopMenu bool
+
+	// DesktopNameTemplate is the name of integrated AppImages in the
+	// menu, %s is replaced by the name from their desktop file
+	DesktopNameTemplate string
+
+	// ShowTerminalApps shows AppImages with Terminal=true in the menu
+	ShowTerminalApps bool
+
+	// ExtractAppImages extracts AppImages when they are installed,
+	// so that they can be launched without FUSE
+	ExtractAppImages bool
+
+	// TrackUsage launches AppImages from ~/.local/bin and the menu
+	// through zap run, which records when they were last used
+	TrackUsage bool
+
+	// WatchDirs are watched by zap daemon, which installs the AppImages
+	// which appear in them, and removes those which disappear
+	WatchDirs []string
+
+	// shell completions and man pages shipped by AppImages
+	InstallBashCompletions bool
+	InstallZshCompletions  bool
+	InstallFishCompletions bool
+	InstallManPages        bool
+
+	// network
+	Proxy          string
+	ConnectTimeout time.Duration
+	ReadTimeout    time.Duration
+	CABundle       string
+	UserAgent      string
+	Netrc          string
+	BearerTokens   map[string]string
 }
 
 const (
@@ -37,8 +79,9 @@ func (store *Store) populateDefaults() {
 	iconStore, err_ := xdg.DataFile("zap/v2/icons")
 	indexStore, err_ := xdg.DataFile("zap/v2/index")
 	applicationsStore, err__ := xdg.DataFile("applications")
-	if err != nil || err_ != nil || err__ != nil {
-		logger.Fatalf("Could not find XDG path, a:%s, b:%s, c:%s", err, err_, err__)
+	cacheStore, err___ := xdg.CacheFile("zap/v2/downloads")
+	if err != nil || err_ != nil || err__ != nil || err___ != nil {
+		logger.Fatalf("Could not find XDG path, a:%s, b:%s, c:%s, d:%s", err, err_, err__, err___)
 	}
 	_ = os.MkdirAll(iconStore, 0777)
 	_ = os.MkdirAll(indexStore, 0777)
@@ -47,16 +90,49 @@ func (store *Store) populateDefaults() {
 	store.LocalStore = localStore
 	store.IndexStore = indexStore
 	store.ApplicationStore = applicationsStore
+	store.CacheStore = cacheStore
 	store.Version = 2
 	store.Integrate = IntegrateAsk
-	store.Mirror = "https://g.srev.in/get-appimage/%s/core.json"
-	store.MirrorRoot = "https://g.srev.in/get-appimage"
+	store.Mirror = []string{"https://g.srev.in/get-appimage/%s/core.json"}
+	store.MirrorRoot = []string{"https://g.srev.in/get-appimage"}
+	store.ConnectTimeout = 30 * time.Second
+	store.ReadTimeout = 60 * time.Second
+	store.BearerTokens = map[string]string{}
+	store.InstallBashCompletions = true
+	store.InstallZshCompletions = true
+	store.InstallFishCompletions = true
+	store.InstallManPages = true
+	store.DesktopNameTemplate = "%s (AppImage)"
 }
 
 func (store *Store) migrate(newStore Store) {
 	if newStore.CustomIconTheme {
 		store.CustomIconTheme = newStore.CustomIconTheme
 	}
+	if newStore.Integrate != "" {
+		store.Integrate = newStore.Integrate
+	}
+	if newStore.UseXdgDesktopMenu {
+		store.UseXdgDesktopMenu = newStore.UseXdgDesktopMenu
+	}
+	if newStore.DesktopNameTemplate != "" {
+		store.DesktopNameTemplate = newStore.DesktopNameTemplate
+	}
+	if newStore.ShowTerminalApps {
+		store.ShowTerminalApps = newStore.ShowTerminalApps
+	}
+	if newStore.TrackUsage {
+		store.TrackUsage = newStore.TrackUsage
+	}
+	if newStore.ExtractAppImages {
+		store.ExtractAppImages = newStore.ExtractAppImages
+	}
+	// these are enabled by default, and are read with their
+	// defaults from the configuration file
+	store.InstallBashCompletions = newStore.InstallBashCompletions
+	store.InstallZshCompletions = newStore.InstallZshCompletions
+	store.InstallFishCompletions = newStore.InstallFishCompletions
+	store.InstallManPages = newStore.InstallManPages
 	if newStore.IconStore != "" {
 		store.IconStore = newStore.IconStore
 	}
@@ -69,10 +145,40 @@ func (store *Store) migrate(newStore Store) {
 	if newStore.ApplicationStore != "" {
 		store.ApplicationStore = newStore.ApplicationStore
 	}
-	if newStore.Mirror != "" {
+	if newStore.CacheStore != "" {
+		store.CacheStore = newStore.CacheStore
+	}
+	if newStore.CacheProxy != "" {
+		store.CacheProxy = newStore.CacheProxy
+	}
+	if newStore.Proxy != "" {
+		store.Proxy = newStore.Proxy
+	}
+	if newStore.ConnectTimeout != 0 {
+		store.ConnectTimeout = newStore.ConnectTimeout
+	}
+	if newStore.ReadTimeout != 0 {
+		store.ReadTimeout = newStore.ReadTimeout
+	}
+	if newStore.CABundle != "" {
+		store.CABundle = newStore.CABundle
+	}
+	if newStore.UserAgent != "" {
+		store.UserAgent = newStore.UserAgent
+	}
+	if newStore.Netrc != "" {
+		store.Netrc = newStore.Netrc
+	}
+	if len(newStore.BearerTokens) > 0 {
+		store.BearerTokens = newStore.BearerTokens
+	}
+	if len(newStore.WatchDirs) > 0 {
+		store.WatchDirs = newStore.WatchDirs
+	}
+	if len(newStore.Mirror) > 0 {
 		store.Mirror = newStore.Mirror
 	}
-	if newStore.MirrorRoot != "" {
+	if len(newStore.MirrorRoot) > 0 {
 		store.MirrorRoot = newStore.MirrorRoot
 	}
 }
@@ -81,34 +187,86 @@ func (store *Store) write(configPath string) error {
 	baseConfig := ini.Empty()
 	zap := baseConfig.Section("Zap")
 	zap.Key("Version").SetValue(strconv.Itoa(store.Version))
-	zap.Key("Mirror").SetValue(store.Mirror)
-	zap.Key("MirrorRoot").SetValue(store.MirrorRoot)
+	zap.Key("Mirror").SetValue(strings.Join(store.Mirror, ", "))
+	zap.Key("MirrorRoot").SetValue(strings.Join(store.MirrorRoot, ", "))
 	zap.Key("ApplicationStore").SetValue(store.ApplicationStore)
 	zap.Key("IconStore").SetValue(store.IconStore)
 	zap.Key("LocalStore").SetValue(store.LocalStore)
+	zap.Key("CacheStore").SetValue(store.CacheStore)
+	zap.Key("CacheProxy").SetValue(store.CacheProxy)
 	zap.Key("CustomIconTheme").SetValue(strconv.FormatBool(store.CustomIconTheme))
 	zap.Key("Integrate").SetValue(store.Integrate)
+	zap.Key("UseXdgDesktopMenu").SetValue(strconv.FormatBool(store.UseXdgDesktopMenu))
+	zap.Key("DesktopNameTemplate").SetValue(store.DesktopNameTemplate)
+	zap.Key("ShowTerminalApps").SetValue(strconv.FormatBool(store.ShowTerminalApps))
+	zap.Key("TrackUsage").SetValue(strconv.FormatBool(store.TrackUsage))
+	zap.Key("ExtractAppImages").SetValue(strconv.FormatBool(store.ExtractAppImages))
+	zap.Key("WatchDirs").SetValue(strings.Join(store.WatchDirs, ", "))
+	zap.Key("InstallBashCompletions").SetValue(strconv.FormatBool(store.InstallBashCompletions))
+	zap.Key("InstallZshCompletions").SetValue(strconv.FormatBool(store.InstallZshCompletions))
+	zap.Key("InstallFishCompletions").SetValue(strconv.FormatBool(store.InstallFishCompletions))
+	zap.Key("InstallManPages").SetValue(strconv.FormatBool(store.InstallManPages))
+	zap.Key("Proxy").SetValue(store.Proxy)
+	zap.Key("ConnectTimeout").SetValue(store.ConnectTimeout.String())
+	zap.Key("ReadTimeout").SetValue(store.ReadTimeout.String())
+	zap.Key("CABundle").SetValue(store.CABundle)
+	zap.Key("UserAgent").SetValue(store.UserAgent)
+	zap.Key("Netrc").SetValue(store.Netrc)
+
+	bearerTokens := baseConfig.Section("BearerTokens")
+	for host, token := range store.BearerTokens {
+		bearerTokens.Key(host).SetValue(token)
+	}
 
 	logger.Debugf("Attempting to write INI v2 configuration into %s", configPath)
-	configFile, err := os.Create(configPath)
+	// the configuration has the bearer tokens, so it is only readable by
+	// the user, and written into a temporary file first, so that it
+	// is never left half written
+	configFile, err := os.CreateTemp(filepath.Dir(configPath), ".config.ini")
 	if err != nil {
 		return err
 	}
+	defer os.Remove(configFile.Name())
 
 	logger.Debugf("Marshalling into configuration file")
 	_, err = baseConfig.WriteTo(configFile)
+	if err == nil {
+		err = configFile.Chmod(0600)
+	}
 	if err != nil {
+		configFile.Close()
 		return err
 	}
 	err = configFile.Close()
 	if err != nil {
 		return err
 	}
+	err = os.Rename(configFile.Name(), configPath)
+	if err != nil {
+		return err
+	}
 
 	logger.Debugf("Configuration file written into '%s' successfully", configPath)
 	return nil
 }
 
+// HTTPOptions returns the configuration of the shared HTTP client. userAgent
+// is used unless the configuration overrides it
+func (store Store) HTTPOptions(userAgent string) helpers.HTTPOptions {
+	if store.UserAgent != "" {
+		userAgent = store.UserAgent
+	}
+	return helpers.HTTPOptions{
+		Proxy:          store.Proxy,
+		ConnectTimeout: store.ConnectTimeout,
+		ReadTimeout:    store.ReadTimeout,
+		CABundle:       store.CABundle,
+		UserAgent:      userAgent,
+		Netrc:          store.Netrc,
+		BearerTokens:   store.BearerTokens,
+	}
+}
+
 // NewZapDefaultConfig creates a fresh configuration for zap from the pre-specified defaults
 func NewZapDefaultConfig() *Store {
 	zapDefaultConfig := &Store{}
@@ -139,15 +297,41 @@ func NewZapConfig(configPath string) (*Store, error) {
 	configCore := config.Section("Zap")
 
 	customStore = &Store{
-		Version:          configCore.Key("Version").MustInt(),
-		Mirror:           configCore.Key("Mirror").String(),
-		LocalStore:       configCore.Key("LocalStore").String(),
-		IndexStore:       configCore.Key("IndexStore").String(),
-		IconStore:        configCore.Key("IconStore").String(),
-		ApplicationStore: configCore.Key("ApplicationStore").String(),
-		CustomIconTheme:  configCore.Key("CustomIconTheme").MustBool(),
-		Integrate:        configCore.Key("Integrate").String(),
+		Version:                configCore.Key("Version").MustInt(),
+		Mirror:                 configCore.Key("Mirror").Strings(","),
+		MirrorRoot:             configCore.Key("MirrorRoot").Strings(","),
+		LocalStore:             configCore.Key("LocalStore").String(),
+		IndexStore:             configCore.Key("IndexStore").String(),
+		IconStore:              configCore.Key("IconStore").String(),
+		ApplicationStore:       configCore.Key("ApplicationStore").String(),
+		CacheStore:             configCore.Key("CacheStore").String(),
+		CacheProxy:             configCore.Key("CacheProxy").String(),
+		CustomIconTheme:        configCore.Key("CustomIconTheme").MustBool(),
+		Integrate:              configCore.Key("Integrate").String(),
+		UseXdgDesktopMenu:      configCore.Key("UseXdgDesktopMenu").MustBool(),
+		DesktopNameTemplate:    configCore.Key("DesktopNameTemplate").String(),
+		ShowTerminalApps:       configCore.Key("ShowTerminalApps").MustBool(),
+		TrackUsage:             configCore.Key("TrackUsage").MustBool(),
+		ExtractAppImages:       configCore.Key("ExtractAppImages").MustBool(),
+		WatchDirs:              configCore.Key("WatchDirs").Strings(","),
+		InstallBashCompletions: configCore.Key("InstallBashCompletions").MustBool(true),
+		InstallZshCompletions:  configCore.Key("InstallZshCompletions").MustBool(true),
+		InstallFishCompletions: configCore.Key("InstallFishCompletions").MustBool(true),
+		InstallManPages:        configCore.Key("InstallManPages").MustBool(true),
+		Proxy:                  configCore.Key("Proxy").String(),
+		ConnectTimeout:         configCore.Key("ConnectTimeout").MustDuration(),
+		ReadTimeout:            configCore.Key("ReadTimeout").MustDuration(),
+		CABundle:               configCore.Key("CABundle").String(),
+		UserAgent:              configCore.Key("UserAgent").String(),
+		Netrc:                  configCore.Key("Netrc").String(),
+		BearerTokens:           config.Section("BearerTokens").KeysHash(),
 	}
+	for i, dir := range customStore.WatchDirs {
+		if strings.HasPrefix(dir, "~/") {
+			customStore.WatchDirs[i] = filepath.Join(xdg.Home, dir[2:])
+		}
+	}
+
 	defStore := &Store{}
 	defStore.populateDefaults()
 	defStore.migrate(*customStore)
@@ -21,7 +21,9 @@ func upgrade(c chan int, s chan os.Signal, updater UpdateFunction) {
 	for {
 		select {
 		case <-c:
+			lock.Lock()
 			apps, _ := updater()
+			lock.Unlock()
 			if len(apps) > 0 {
 				logger.Infof("Apps have been updated, %s", apps)
 				err := beeep.Notify("Zap ⚡️",
@@ -0,0 +1,133 @@
+package daemon
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+	"unsafe"
+)
+
+// WatchFunction is called with the path of an appimage which appeared in,
+// or disappeared from one of the watched directories
+type WatchFunction func(file string) error
+
+// removeDelay is how long the removal of an appimage is put off, so that
+// an appimage which was moved is found at its new path first
+const removeDelay = 10 * time.Second
+
+// lock keeps the watcher and the updater from changing
+// the installed apps at the same time
+var lock sync.Mutex
+
+// isAppImageName returns true if name is the name of an appimage, and not
+// of a hidden file, like the partial downloads of some browsers
+func isAppImageName(name string) bool {
+	return !strings.HasPrefix(name, ".") && strings.HasSuffix(strings.ToLower(name), ".appimage")
+}
+
+// handleWatchEvent calls fn with file, while no other change is made
+// to the installed apps
+func handleWatchEvent(event string, file string, fn WatchFunction) {
+	lock.Lock()
+	defer lock.Unlock()
+
+	logger.Infof("zapd: %s %s", file, event)
+	err := fn(file)
+	if err != nil {
+		logger.Warnf("zapd: Failed to handle %s, %s", file, err)
+	}
+}
+
+// Watch watches dirs with inotify. created is called with the appimages
+// in dirs, and with each appimage which is written or moved into one of
+// them. removed is called with each appimage which is deleted or moved
+// out of one of them, after removeDelay
+func Watch(dirs []string, created WatchFunction, removed WatchFunction) error {
+	fd, err := syscall.InotifyInit1(syscall.IN_CLOEXEC)
+	if err != nil {
+		return os.NewSyscallError("inotify_init1", err)
+	}
+
+	watches := map[int]string{}
+	for _, dir := range dirs {
+		dir, err = filepath.Abs(dir)
+		if err == nil {
+			err = os.MkdirAll(dir, 0755)
+		}
+		if err != nil {
+			_ = syscall.Close(fd)
+			return err
+		}
+		wd, err := syscall.InotifyAddWatch(fd, dir,
+			syscall.IN_CLOSE_WRITE|syscall.IN_MOVED_TO|syscall.IN_DELETE|syscall.IN_MOVED_FROM)
+		if err != nil {
+			_ = syscall.Close(fd)
+			return fmt.Errorf("failed to watch %s, %s", dir, err)
+		}
+		watches[wd] = dir
+		logger.Infof("zapd: Watching %s", dir)
+	}
+
+	// the appimages which were added while zapd was not running
+	for _, dir := range watches {
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			continue
+		}
+		for _, entry := range entries {
+			if !entry.IsDir() && isAppImageName(entry.Name()) {
+				handleWatchEvent("found", path.Join(dir, entry.Name()), created)
+			}
+		}
+	}
+
+	go watch(fd, watches, created, removed)
+	return nil
+}
+
+func watch(fd int, watches map[int]string, created WatchFunction, removed WatchFunction) {
+	defer syscall.Close(fd)
+
+	buf := make([]byte, 64*(syscall.SizeofInotifyEvent+syscall.NAME_MAX+1))
+	for {
+		n, err := syscall.Read(fd, buf)
+		if err == syscall.EINTR {
+			continue
+		}
+		if err != nil {
+			logger.Warnf("zapd: Failed to read inotify events, stopped watching, %s", err)
+			return
+		}
+
+		for offset := 0; offset+syscall.SizeofInotifyEvent <= n; {
+			event := (*syscall.InotifyEvent)(unsafe.Pointer(&buf[offset]))
+			nameStart := offset + syscall.SizeofInotifyEvent
+			offset = nameStart + int(event.Len)
+
+			if event.Mask&syscall.IN_Q_OVERFLOW != 0 {
+				logger.Warnf("zapd: Too many changes in the watched directories, some were missed")
+				continue
+			}
+			dir, ok := watches[int(event.Wd)]
+			name := strings.TrimRight(string(buf[nameStart:offset]), "\x00")
+			if !ok || !isAppImageName(name) {
+				continue
+			}
+			file := path.Join(dir, name)
+
+			switch {
+			case event.Mask&(syscall.IN_CLOSE_WRITE|syscall.IN_MOVED_TO) != 0:
+				handleWatchEvent("appeared", file, created)
+			case event.Mask&(syscall.IN_DELETE|syscall.IN_MOVED_FROM) != 0:
+				time.AfterFunc(removeDelay, func() {
+					handleWatchEvent("disappeared", file, removed)
+				})
+			}
+		}
+	}
+}
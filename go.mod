@@ -22,4 +22,5 @@ require (
 	github.com/withmandala/go-log v0.1.0
 	golang.org/x/net v0.14.0 // indirect
 	gopkg.in/ini.v1 v1.67.0
+	gopkg.in/yaml.v3 v3.0.1
 )
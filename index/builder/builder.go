@@ -0,0 +1,343 @@
+package builder
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/srevinsaju/zap/internal/helpers"
+	"github.com/srevinsaju/zap/logging"
+	"github.com/srevinsaju/zap/tui"
+	"github.com/srevinsaju/zap/types"
+)
+
+var logger = logging.GetLogger()
+
+// Options configures where and how the index is generated
+type Options struct {
+	// Output is the directory which would be hosted by a web server
+	Output string
+
+	// BaseURL is the URL at which Output will be served. It is used
+	// to generate the download links of local AppImages
+	BaseURL string
+
+	// Maintainer is used for apps which do not declare one
+	Maintainer string
+}
+
+// coreRelease is a single release as stored in <app>/core.json
+type coreRelease struct {
+	PreRelease  bool                        `json:"prerelease"`
+	Tag         string                      `json:"tag"`
+	PublishedAt string                      `json:"published_at"`
+	Assets      map[string]types.ZapDlAsset `json:"assets"`
+}
+
+type builder struct {
+	options   Options
+	inspected map[string]*metadata
+}
+
+// FromDirectory generates an index from all the AppImages found in dir.
+// AppImages are grouped into apps by the name in their desktop file, and
+// into releases by their X-AppImage-Version
+func FromDirectory(dir string, options Options) error {
+	b := &builder{options: options, inspected: map[string]*metadata{}}
+
+	files, err := filepath.Glob(filepath.Join(dir, "*"))
+	if err != nil {
+		return err
+	}
+
+	description := &Description{Maintainer: options.Maintainer}
+	apps := map[string]*DescribedApp{}
+	var appIds []string
+
+	for _, file := range files {
+		if !strings.HasSuffix(strings.ToLower(file), ".appimage") {
+			continue
+		}
+		fmt.Printf("%s %s\n", tui.Blue("[index]"), filepath.Base(file))
+		meta, err := b.inspect(file)
+		if err != nil {
+			logger.Warnf("Skipping %s, %s", file, err)
+			continue
+		}
+
+		app, ok := apps[meta.Id]
+		if !ok {
+			app = &DescribedApp{Id: meta.Id}
+			apps[meta.Id] = app
+			appIds = append(appIds, meta.Id)
+		}
+
+		tag := meta.Version
+		if tag == "" {
+			tag = "latest"
+		}
+		var release *DescribedRelease
+		for i := range app.Releases {
+			if app.Releases[i].Tag == tag {
+				release = &app.Releases[i]
+			}
+		}
+		if release == nil {
+			app.Releases = append(app.Releases, DescribedRelease{Tag: tag})
+			release = &app.Releases[len(app.Releases)-1]
+		}
+		release.Assets = append(release.Assets, DescribedAsset{Path: file})
+	}
+
+	for _, id := range appIds {
+		description.Apps = append(description.Apps, *apps[id])
+	}
+	return b.build(description, dir)
+}
+
+// FromDescription generates an index from the YAML description at path.
+// Relative asset paths are resolved relative to the description file
+func FromDescription(path string, options Options) error {
+	b := &builder{options: options, inspected: map[string]*metadata{}}
+
+	description, err := LoadDescription(path)
+	if err != nil {
+		return err
+	}
+	if description.Maintainer == "" {
+		description.Maintainer = options.Maintainer
+	}
+	return b.build(description, filepath.Dir(path))
+}
+
+func (b *builder) inspect(file string) (*metadata, error) {
+	if meta, ok := b.inspected[file]; ok {
+		return meta, nil
+	}
+	meta, err := inspect(file)
+	if err != nil {
+		return nil, err
+	}
+	b.inspected[file] = meta
+	return meta, nil
+}
+
+// url returns the URL at which a file relative to the output directory
+// will be served
+func (b *builder) url(rel string) string {
+	if b.options.BaseURL == "" {
+		return rel
+	}
+	return fmt.Sprintf("%s/%s", strings.TrimRight(b.options.BaseURL, "/"), rel)
+}
+
+func (b *builder) build(description *Description, relativeTo string) error {
+	var index []types.ZapIndex
+
+	for _, app := range description.Apps {
+		if app.Id == "" {
+			return errors.New("every app in the description needs an id")
+		}
+		logger.Debugf("Generating index for %s", app.Id)
+
+		appDir := filepath.Join(b.options.Output, app.Id)
+		err := os.MkdirAll(appDir, 0755)
+		if err != nil {
+			return err
+		}
+
+		var icon []byte
+		iconExt := ""
+		if app.Icon != "" {
+			icon, err = os.ReadFile(resolve(relativeTo, app.Icon))
+			if err != nil {
+				return err
+			}
+			iconExt = strings.TrimPrefix(filepath.Ext(app.Icon), ".")
+		}
+
+		releases := make([]coreRelease, 0, len(app.Releases))
+		for _, describedRelease := range app.Releases {
+			release := coreRelease{
+				PreRelease:  describedRelease.PreRelease,
+				Tag:         describedRelease.Tag,
+				PublishedAt: describedRelease.PublishedAt,
+				Assets:      map[string]types.ZapDlAsset{},
+			}
+
+			for i, describedAsset := range describedRelease.Assets {
+				asset := types.ZapDlAsset{
+					Name:     describedAsset.Name,
+					Download: describedAsset.Download,
+					Size:     describedAsset.Size,
+					Sha256:   describedAsset.Sha256,
+					Arch:     describedAsset.Arch,
+				}
+
+				if describedAsset.Path != "" {
+					if b.options.BaseURL == "" {
+						return errors.New("a base url is required to index local AppImages")
+					}
+
+					file := resolve(relativeTo, describedAsset.Path)
+					meta, err := b.inspect(file)
+					if err != nil {
+						return err
+					}
+
+					if app.Name == "" {
+						app.Name = meta.Name
+					}
+					if app.Summary == "" {
+						app.Summary = meta.Summary
+					}
+					if app.Maintainer == "" {
+						app.Maintainer = meta.Maintainer
+					}
+					if icon == nil && meta.Icon != nil {
+						icon, iconExt = meta.Icon, meta.IconExt
+					}
+					if release.Tag == "" {
+						release.Tag = meta.Version
+					}
+					if release.PublishedAt == "" {
+						if info, err := os.Stat(file); err == nil {
+							release.PublishedAt = info.ModTime().UTC().Format(time.RFC3339)
+						}
+					}
+
+					baseName := filepath.Base(file)
+					logger.Debugf("Copying %s into the index", baseName)
+					if err := linkOrCopy(file, filepath.Join(appDir, baseName)); err != nil {
+						return err
+					}
+
+					if asset.Name == "" {
+						asset.Name = baseName
+					}
+					asset.Download = b.url(fmt.Sprintf("%s/%s", app.Id, baseName))
+					if asset.Size == "" {
+						asset.Size = meta.Size
+					}
+					if asset.Sha256 == "" {
+						asset.Sha256 = meta.Sha256
+					}
+					if asset.Arch == "" {
+						asset.Arch = meta.Arch
+					}
+				}
+
+				if asset.Download == "" {
+					return fmt.Errorf("asset %d of %s %s has neither a path nor a download url",
+						i, app.Id, describedRelease.Tag)
+				}
+				if asset.Name == "" {
+					asset.Name = filepath.Base(asset.Download)
+				}
+				if asset.Size == "" {
+					asset.Size = "(unknown)"
+				}
+				release.Assets[strconv.Itoa(i)] = asset
+			}
+
+			if release.Tag == "" {
+				release.Tag = "latest"
+			}
+			if release.PublishedAt == "" {
+				release.PublishedAt = time.Now().UTC().Format(time.RFC3339)
+			}
+			releases = append(releases, release)
+		}
+
+		// zap considers the first release to be the latest one
+		sort.SliceStable(releases, func(i, j int) bool {
+			return releases[i].PublishedAt > releases[j].PublishedAt
+		})
+
+		if app.Name == "" {
+			app.Name = app.Id
+		}
+		if app.Maintainer == "" {
+			app.Maintainer = description.Maintainer
+		}
+		if app.Source.Type == "" {
+			app.Source = types.ZapSource{Type: "url", Url: b.url(app.Id)}
+		}
+
+		image := ""
+		if icon != nil {
+			if iconExt == "" {
+				iconExt = "png"
+			}
+			iconName := fmt.Sprintf("icon.%s", iconExt)
+			err = os.WriteFile(filepath.Join(appDir, iconName), icon, 0644)
+			if err != nil {
+				return err
+			}
+			image = b.url(fmt.Sprintf("%s/%s", app.Id, iconName))
+		}
+
+		core := map[string]interface{}{
+			"owner":  app.Maintainer,
+			"source": app.Source,
+		}
+		for i := range releases {
+			core[strconv.Itoa(i)] = releases[i]
+		}
+		err = writeJSON(filepath.Join(appDir, "core.json"), core)
+		if err != nil {
+			return err
+		}
+
+		index = append(index, types.ZapIndex{
+			Id:         app.Id,
+			Name:       app.Name,
+			Image:      image,
+			Maintainer: app.Maintainer,
+			Summary:    app.Summary,
+			Links:      app.Links,
+		})
+	}
+
+	sort.Slice(index, func(i, j int) bool {
+		return index[i].Id < index[j].Id
+	})
+	return writeJSON(filepath.Join(b.options.Output, "index.min.json"), index)
+}
+
+// resolve returns path, relative to dir if it is not absolute
+func resolve(dir string, path string) string {
+	if filepath.IsAbs(path) {
+		return path
+	}
+	return filepath.Join(dir, path)
+}
+
+// linkOrCopy tries to hard link src to dst, so that large AppImages do not
+// take up space twice, and falls back to copying
+func linkOrCopy(src string, dst string) error {
+	_ = os.Remove(dst)
+	if err := os.Link(src, dst); err == nil {
+		return nil
+	}
+	if !helpers.CheckIfFileExists(src) {
+		return fmt.Errorf("%s does not exist", src)
+	}
+	_, err := helpers.CopyFile(src, dst)
+	return err
+}
+
+func writeJSON(path string, v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	logger.Debugf("Writing %s", path)
+	return os.WriteFile(path, data, 0644)
+}
@@ -0,0 +1,73 @@
+package builder
+
+import (
+	"os"
+
+	"github.com/srevinsaju/zap/types"
+	"gopkg.in/yaml.v3"
+)
+
+// Description is a YAML document describing the apps of an index,
+// for the cases where scanning a directory of AppImages is not enough,
+// for example, when the AppImages are hosted elsewhere
+//
+//	maintainer: IT department
+//	apps:
+//	  - id: firefox
+//	    summary: Web browser
+//	    releases:
+//	      - tag: "118.0"
+//	        assets:
+//	          - path: ./Firefox-118.0-x86_64.AppImage
+//	          - download: https://example.com/Firefox-118.0-aarch64.AppImage
+//	            arch: aarch64
+//	            sha256: 9f86d0...
+type Description struct {
+	Maintainer string         `yaml:"maintainer"`
+	Apps       []DescribedApp `yaml:"apps"`
+}
+
+type DescribedApp struct {
+	Id         string             `yaml:"id"`
+	Name       string             `yaml:"name"`
+	Summary    string             `yaml:"summary"`
+	Maintainer string             `yaml:"maintainer"`
+	Icon       string             `yaml:"icon"`
+	Source     types.ZapSource    `yaml:"source"`
+	Links      []types.ZapSource  `yaml:"links"`
+	Releases   []DescribedRelease `yaml:"releases"`
+}
+
+type DescribedRelease struct {
+	Tag         string           `yaml:"tag"`
+	PreRelease  bool             `yaml:"prerelease"`
+	PublishedAt string           `yaml:"published_at"`
+	Assets      []DescribedAsset `yaml:"assets"`
+}
+
+// DescribedAsset is either a local AppImage, given by Path, whose
+// metadata is extracted and which is copied into the index, or a remote
+// AppImage given by Download, which is listed as is
+type DescribedAsset struct {
+	Path     string `yaml:"path"`
+	Name     string `yaml:"name"`
+	Download string `yaml:"download"`
+	Size     string `yaml:"size"`
+	Sha256   string `yaml:"sha256"`
+	Arch     string `yaml:"arch"`
+}
+
+// LoadDescription reads a YAML description of apps from path
+func LoadDescription(path string) (*Description, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	description := &Description{}
+	err = yaml.Unmarshal(data, description)
+	if err != nil {
+		return nil, err
+	}
+	return description, nil
+}
@@ -0,0 +1,173 @@
+package builder
+
+import (
+	"encoding/xml"
+	"errors"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/gabriel-vasile/mimetype"
+	"github.com/srevinsaju/zap/appimage"
+	"github.com/srevinsaju/zap/internal/helpers"
+	"github.com/srevinsaju/zap/tui"
+	"gopkg.in/ini.v1"
+)
+
+// metadata holds everything we could learn about a single AppImage
+// file, from the file itself, its desktop file and AppStream metainfo
+type metadata struct {
+	Id         string
+	Name       string
+	Summary    string
+	Version    string
+	Maintainer string
+	Arch       string
+	Sha256     string
+	Size       string
+	Icon       []byte
+	IconExt    string
+}
+
+// appStreamComponent is the subset of the AppStream metainfo
+// specification which is needed for the index
+type appStreamComponent struct {
+	Id             string          `xml:"id"`
+	Names          []appStreamText `xml:"name"`
+	Summaries      []appStreamText `xml:"summary"`
+	Developers     []appStreamText `xml:"developer>name"`
+	DeveloperNames []appStreamText `xml:"developer_name"`
+}
+
+// appStreamText is an element of the metainfo, which is repeated for
+// each language it is translated to
+type appStreamText struct {
+	Lang  string `xml:"lang,attr"`
+	Value string `xml:",chardata"`
+}
+
+// untranslated returns the text without a language, the translations
+// are not used in the index
+func untranslated(texts []appStreamText) string {
+	for i := range texts {
+		if texts[i].Lang == "" {
+			return strings.TrimSpace(texts[i].Value)
+		}
+	}
+	return ""
+}
+
+// developer returns the name of the developer, <developer_name> is
+// deprecated in favor of <developer><name>, but still common
+func (component appStreamComponent) developer() string {
+	if developer := untranslated(component.Developers); developer != "" {
+		return developer
+	}
+	return untranslated(component.DeveloperNames)
+}
+
+var nonAlphanumeric = regexp.MustCompile(`[^a-z0-9]+`)
+
+// slugify converts a human-readable application name into an
+// identifier which can be used as `zap install <id>`
+func slugify(name string) string {
+	return strings.Trim(nonAlphanumeric.ReplaceAllString(strings.ToLower(name), "-"), "-")
+}
+
+// idFromFileName guesses the application identifier from file names
+// like Firefox-118.0-x86_64.AppImage
+func idFromFileName(file string) string {
+	base := strings.TrimSuffix(filepath.Base(file), filepath.Ext(file))
+	fields := strings.FieldsFunc(base, func(r rune) bool {
+		return r == '-' || r == '_'
+	})
+	if len(fields) == 0 {
+		return ""
+	}
+	return slugify(fields[0])
+}
+
+// inspect extracts the metadata of the AppImage at file. The file is
+// executed with --appimage-extract, so if the AppImage was built for
+// another architecture, we fall back to what we can learn from the
+// file name and the ELF header
+func inspect(file string) (*metadata, error) {
+	file, err := filepath.Abs(file)
+	if err != nil {
+		return nil, err
+	}
+
+	meta := &metadata{Id: idFromFileName(file)}
+
+	logger.Debugf("Calculating checksum of %s", file)
+	meta.Sha256, err = helpers.Sha256File(file)
+	if err != nil {
+		return nil, err
+	}
+
+	info, err := os.Stat(file)
+	if err != nil {
+		return nil, err
+	}
+	meta.Size = tui.HumanizeBytes(info.Size())
+
+	meta.Arch, err = helpers.ElfArch(file)
+	if err != nil {
+		logger.Warnf("Could not detect architecture of %s, %s", file, err)
+	}
+
+	app := appimage.AppImage{Filepath: file}
+
+	dir, err := os.MkdirTemp("", "zap")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+
+	if desktopFileData, err := app.ExtractDesktopFile(); err == nil {
+		desktopFile, err := ini.LoadSources(ini.LoadOptions{IgnoreInlineComment: true}, desktopFileData)
+		if err == nil {
+			desktopEntry := desktopFile.Section("Desktop Entry")
+			meta.Name = desktopEntry.Key("Name").String()
+			meta.Summary = desktopEntry.Key("Comment").String()
+			meta.Version = desktopEntry.Key("X-AppImage-Version").String()
+			if meta.Name != "" {
+				meta.Id = slugify(meta.Name)
+			}
+		}
+	} else {
+		logger.Warnf("Could not extract desktop file from %s", file)
+	}
+
+	// AppStream metainfo is more descriptive than the desktop file
+	// so it takes precedence, if present
+	if metaInfo := app.Extract(dir, "usr/share/metainfo/*.xml"); metaInfo != "" {
+		data, err := os.ReadFile(metaInfo)
+		component := appStreamComponent{}
+		if err == nil && xml.Unmarshal(data, &component) == nil {
+			if name := untranslated(component.Names); name != "" {
+				meta.Name = name
+			}
+			if summary := untranslated(component.Summaries); summary != "" {
+				meta.Summary = summary
+			}
+			meta.Maintainer = component.developer()
+		}
+	}
+
+	if dirIcon := app.Extract(dir, ".DirIcon"); dirIcon != "" {
+		meta.Icon, err = os.ReadFile(dirIcon)
+		if err == nil {
+			meta.IconExt = strings.TrimPrefix(mimetype.Detect(meta.Icon).Extension(), ".")
+		}
+	}
+
+	if meta.Id == "" {
+		return nil, errors.New("its id could not be guessed from its name, or from its file name")
+	}
+	if meta.Name == "" {
+		meta.Name = meta.Id
+	}
+	return meta, nil
+}
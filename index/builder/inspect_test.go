@@ -0,0 +1,77 @@
+package builder
+
+import (
+	"encoding/xml"
+	"testing"
+)
+
+func TestAppStreamComponent(t *testing.T) {
+	tests := []struct {
+		name          string
+		metainfo      string
+		wantName      string
+		wantSummary   string
+		wantDeveloper string
+	}{
+		{
+			name: "translations after the untranslated text",
+			metainfo: `<?xml version="1.0" encoding="UTF-8"?>
+<component type="desktop-application">
+  <id>org.example.Foo</id>
+  <name>Foo</name>
+  <name xml:lang="de">Fu</name>
+  <summary>Does foo</summary>
+  <summary xml:lang="de">Macht fu</summary>
+  <developer_name>Foo Developers</developer_name>
+  <developer_name xml:lang="de">Fu Entwickler</developer_name>
+</component>`,
+			wantName: "Foo", wantSummary: "Does foo", wantDeveloper: "Foo Developers",
+		},
+		{
+			name: "translations before the untranslated text",
+			metainfo: `<component>
+  <name xml:lang="de">Fu</name>
+  <name>Foo</name>
+  <summary xml:lang="es_419">Hace foo</summary>
+  <summary>
+    Does foo
+  </summary>
+</component>`,
+			wantName: "Foo", wantSummary: "Does foo",
+		},
+		{
+			name: "developer element",
+			metainfo: `<component>
+  <name>Foo</name>
+  <developer id="org.example">
+    <name>Example</name>
+    <name xml:lang="de">Beispiel</name>
+  </developer>
+  <developer_name>Legacy</developer_name>
+</component>`,
+			wantName: "Foo", wantDeveloper: "Example",
+		},
+		{
+			name:     "only translations",
+			metainfo: `<component><name xml:lang="de">Fu</name></component>`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			component := appStreamComponent{}
+			err := xml.Unmarshal([]byte(tt.metainfo), &component)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := untranslated(component.Names); got != tt.wantName {
+				t.Errorf("name = %q, want %q", got, tt.wantName)
+			}
+			if got := untranslated(component.Summaries); got != tt.wantSummary {
+				t.Errorf("summary = %q, want %q", got, tt.wantSummary)
+			}
+			if got := component.developer(); got != tt.wantDeveloper {
+				t.Errorf("developer = %q, want %q", got, tt.wantDeveloper)
+			}
+		})
+	}
+}
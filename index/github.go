@@ -34,7 +34,7 @@ func GitHubSurveyUserReleases(options types.InstallOptions, config config.Store)
 	var asset types.ZapDlAsset
 
 	logger.Debugf("Creating github client")
-	client := github.NewClient(nil)
+	client := github.NewClient(helpers.HTTPClient())
 
 	slugProcessed := strings.Split(options.From, "/")
 
@@ -0,0 +1,158 @@
+package index
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/adrg/xdg"
+	"github.com/srevinsaju/zap/internal/helpers"
+)
+
+// NotFoundError is returned by Fetch when every reachable mirror
+// responded, but none of them had the requested file
+var NotFoundError = errors.New("not found on any of the configured mirrors")
+
+// mirrorHealth is the state zap remembers about a mirror across invocations,
+// so that a mirror which is down is not tried first every time
+type mirrorHealth struct {
+	Failures    int       `json:"failures"`
+	LastFailure time.Time `json:"last_failure,omitempty"`
+	LastSuccess time.Time `json:"last_success,omitempty"`
+}
+
+// healthy returns true if the mirror is not cooling down after
+// a failure. The cool-down doubles with every consecutive failure,
+// starting at one minute, up to an hour
+func (h mirrorHealth) healthy() bool {
+	if h.Failures == 0 {
+		return true
+	}
+	coolDown := time.Hour
+	if h.Failures < 7 {
+		coolDown = time.Minute * time.Duration(1<<uint(h.Failures-1))
+	}
+	return time.Since(h.LastFailure) > coolDown
+}
+
+func mirrorHealthPath() (string, error) {
+	return xdg.CacheFile("zap/v2/mirrors.json")
+}
+
+func loadMirrorHealth() map[string]mirrorHealth {
+	health := map[string]mirrorHealth{}
+
+	healthPath, err := mirrorHealthPath()
+	if err != nil {
+		return health
+	}
+	data, err := os.ReadFile(healthPath)
+	if err != nil {
+		return health
+	}
+	err = json.Unmarshal(data, &health)
+	if err != nil {
+		logger.Debugf("Ignoring corrupt mirror health file %s, %s", healthPath, err)
+		return map[string]mirrorHealth{}
+	}
+	return health
+}
+
+func saveMirrorHealth(health map[string]mirrorHealth) {
+	healthPath, err := mirrorHealthPath()
+	if err != nil {
+		logger.Debug(err)
+		return
+	}
+	data, err := json.Marshal(health)
+	if err != nil {
+		logger.Debug(err)
+		return
+	}
+	err = os.WriteFile(healthPath, data, 0644)
+	if err != nil {
+		logger.Debugf("Failed to write mirror health to %s, %s", healthPath, err)
+	}
+}
+
+// orderMirrors sorts the mirrors so that healthy mirrors are tried first,
+// in the order they were configured, followed by the mirrors which are
+// cooling down, the one which failed the longest time ago first
+func orderMirrors(mirrors []string, health map[string]mirrorHealth) []string {
+	ordered := make([]string, len(mirrors))
+	copy(ordered, mirrors)
+	sort.SliceStable(ordered, func(i, j int) bool {
+		a, b := health[ordered[i]], health[ordered[j]]
+		if a.healthy() != b.healthy() {
+			return a.healthy()
+		}
+		if a.healthy() {
+			return false
+		}
+		return a.LastFailure.Before(b.LastFailure)
+	})
+	return ordered
+}
+
+// Fetch tries each of the mirrors, healthiest first, and returns the
+// body of the first successful response. url maps a mirror to the URL
+// which is requested from it. A mirror which cannot be reached, or which
+// responds with a server error is marked as failing. A mirror which
+// does not have the file is skipped, without being marked as failing.
+func Fetch(mirrors []string, url func(mirror string) string) ([]byte, error) {
+	if len(mirrors) == 0 {
+		return nil, errors.New("no mirrors are configured")
+	}
+
+	health := loadMirrorHealth()
+	defer saveMirrorHealth(health)
+
+	var lastErr error = NotFoundError
+	for _, mirror := range orderMirrors(mirrors, health) {
+		targetUrl := url(mirror)
+		logger.Debugf("Fetching %s", targetUrl)
+
+		body, err := fetch(targetUrl)
+		h := health[mirror]
+		if err == NotFoundError {
+			logger.Debugf("%s does not exist on %s", targetUrl, mirror)
+			h.Failures = 0
+			h.LastSuccess = time.Now()
+			health[mirror] = h
+			continue
+		} else if err != nil {
+			logger.Warnf("Mirror %s failed, %s", mirror, err)
+			h.Failures += 1
+			h.LastFailure = time.Now()
+			health[mirror] = h
+			lastErr = err
+			continue
+		}
+
+		h.Failures = 0
+		h.LastSuccess = time.Now()
+		health[mirror] = h
+		return body, nil
+	}
+	return nil, lastErr
+}
+
+func fetch(targetUrl string) ([]byte, error) {
+	resp, err := helpers.HTTPClient().Get(targetUrl)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, NotFoundError
+	} else if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected response %s", resp.Status)
+	}
+	return io.ReadAll(resp.Body)
+}
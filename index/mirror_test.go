@@ -0,0 +1,165 @@
+package index
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/adrg/xdg"
+)
+
+// useTempCache keeps the mirror health of a test in a temporary directory
+func useTempCache(t *testing.T) {
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+	xdg.Reload()
+	t.Cleanup(xdg.Reload)
+}
+
+// mirrorServer serves body at /core.json with status, and counts the requests
+func mirrorServer(t *testing.T, status int, body string) (*httptest.Server, *int) {
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if r.URL.Path != "/core.json" {
+			http.NotFound(w, r)
+			return
+		}
+		w.WriteHeader(status)
+		fmt.Fprint(w, body)
+	}))
+	t.Cleanup(server.Close)
+	return server, &requests
+}
+
+func coreJson(mirror string) string {
+	return mirror + "/core.json"
+}
+
+func TestFetchFailsOver(t *testing.T) {
+	useTempCache(t)
+	broken, brokenRequests := mirrorServer(t, http.StatusInternalServerError, "")
+	working, _ := mirrorServer(t, http.StatusOK, "from working")
+
+	body, err := Fetch([]string{broken.URL, working.URL}, coreJson)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(body) != "from working" {
+		t.Errorf("body = %q, want %q", body, "from working")
+	}
+
+	health := loadMirrorHealth()
+	if health[broken.URL].Failures != 1 || health[broken.URL].healthy() {
+		t.Errorf("health of the broken mirror = %+v, want one failure, cooling down", health[broken.URL])
+	}
+	if health[working.URL].Failures != 0 || health[working.URL].LastSuccess.IsZero() {
+		t.Errorf("health of the working mirror = %+v, want a success", health[working.URL])
+	}
+
+	// the broken mirror is cooling down, so it is tried last
+	_, err = Fetch([]string{broken.URL, working.URL}, coreJson)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if *brokenRequests != 1 {
+		t.Errorf("the broken mirror was requested %d times, want 1", *brokenRequests)
+	}
+}
+
+func TestFetchUnreachableMirror(t *testing.T) {
+	useTempCache(t)
+	unreachable := httptest.NewServer(http.NotFoundHandler())
+	unreachable.Close()
+	working, _ := mirrorServer(t, http.StatusOK, "from working")
+
+	body, err := Fetch([]string{unreachable.URL, working.URL}, coreJson)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(body) != "from working" {
+		t.Errorf("body = %q, want %q", body, "from working")
+	}
+	if health := loadMirrorHealth(); health[unreachable.URL].Failures != 1 {
+		t.Errorf("health of the unreachable mirror = %+v, want one failure", health[unreachable.URL])
+	}
+}
+
+func TestFetchNotFoundIsNotAFailure(t *testing.T) {
+	useTempCache(t)
+	missing, _ := mirrorServer(t, http.StatusNotFound, "")
+	working, _ := mirrorServer(t, http.StatusOK, "from working")
+
+	body, err := Fetch([]string{missing.URL, working.URL}, coreJson)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(body) != "from working" {
+		t.Errorf("body = %q, want %q", body, "from working")
+	}
+	health := loadMirrorHealth()
+	if health[missing.URL].Failures != 0 || !health[missing.URL].healthy() {
+		t.Errorf("health of the mirror without the file = %+v, want healthy", health[missing.URL])
+	}
+
+	_, err = Fetch([]string{missing.URL}, coreJson)
+	if err != NotFoundError {
+		t.Errorf("error = %v, want NotFoundError", err)
+	}
+}
+
+func TestFetchAllMirrorsFail(t *testing.T) {
+	useTempCache(t)
+	missing, _ := mirrorServer(t, http.StatusNotFound, "")
+	broken, _ := mirrorServer(t, http.StatusBadGateway, "")
+
+	_, err := Fetch([]string{missing.URL, broken.URL}, coreJson)
+	if err == nil || err == NotFoundError {
+		t.Errorf("error = %v, want the error of the broken mirror", err)
+	}
+
+	_, err = Fetch(nil, coreJson)
+	if err == nil {
+		t.Error("fetching without mirrors did not fail")
+	}
+}
+
+func TestMirrorHealthCoolDown(t *testing.T) {
+	tests := []struct {
+		failures  int
+		failedAgo time.Duration
+		want      bool
+	}{
+		{failures: 0, want: true},
+		{failures: 1, failedAgo: 30 * time.Second, want: false},
+		{failures: 1, failedAgo: 2 * time.Minute, want: true},
+		{failures: 3, failedAgo: 3 * time.Minute, want: false},
+		{failures: 3, failedAgo: 5 * time.Minute, want: true},
+		{failures: 20, failedAgo: 59 * time.Minute, want: false},
+		{failures: 20, failedAgo: 61 * time.Minute, want: true},
+	}
+	for _, tt := range tests {
+		h := mirrorHealth{Failures: tt.failures, LastFailure: time.Now().Add(-tt.failedAgo)}
+		if got := h.healthy(); got != tt.want {
+			t.Errorf("healthy() after %d failures, %s ago = %v, want %v", tt.failures, tt.failedAgo, got, tt.want)
+		}
+	}
+}
+
+func TestOrderMirrors(t *testing.T) {
+	now := time.Now()
+	health := map[string]mirrorHealth{
+		"a": {Failures: 1, LastFailure: now.Add(-10 * time.Second)},
+		"b": {Failures: 0, LastSuccess: now},
+		"c": {Failures: 2, LastFailure: now.Add(-30 * time.Second)},
+		// cooled down
+		"e": {Failures: 1, LastFailure: now.Add(-time.Hour)},
+	}
+	got := orderMirrors([]string{"a", "b", "c", "d", "e"}, health)
+	want := []string{"b", "d", "e", "c", "a"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("orderMirrors() = %v, want %v", got, want)
+	}
+}
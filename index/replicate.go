@@ -0,0 +1,198 @@
+package index
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/srevinsaju/zap/cache"
+	"github.com/srevinsaju/zap/config"
+	"github.com/srevinsaju/zap/tui"
+	"github.com/srevinsaju/zap/types"
+)
+
+// ReplicateOptions configures Replicate
+type ReplicateOptions struct {
+	// Apps limits the replication to the given app ids, all the apps
+	// in the index are replicated if it is empty
+	Apps []string
+
+	// WithAssets downloads the AppImages too, and rewrites the download
+	// links to point to BaseURL
+	WithAssets bool
+
+	// LatestOnly limits the downloaded AppImages to the latest release
+	LatestOnly bool
+
+	// BaseURL is the URL at which the target directory will be served
+	BaseURL string
+}
+
+// Replicate copies the index JSON from the configured mirrors into dir,
+// in the same layout, so that dir can be served as a mirror on networks
+// which cannot reach the upstream mirrors
+func Replicate(dir string, options ReplicateOptions, config config.Store) error {
+	if options.WithAssets && options.BaseURL == "" {
+		return errors.New("a base url is required to replicate assets")
+	}
+
+	logger.Debug("Fetching index.min.json")
+	indexBytes, err := Fetch(config.MirrorRoot, func(mirror string) string {
+		return fmt.Sprintf("%s/%s", mirror, "index.min.json")
+	})
+	if err != nil {
+		return err
+	}
+
+	var apps []types.ZapIndex
+	err = json.Unmarshal(indexBytes, &apps)
+	if err != nil {
+		return err
+	}
+
+	if len(options.Apps) > 0 {
+		var selectedApps []types.ZapIndex
+		for _, app := range apps {
+			for _, id := range options.Apps {
+				if strings.EqualFold(app.Id, id) || strings.EqualFold(app.Name, id) {
+					selectedApps = append(selectedApps, app)
+				}
+			}
+		}
+		apps = selectedApps
+	}
+
+	err = os.MkdirAll(dir, 0755)
+	if err != nil {
+		return err
+	}
+
+	replicated := []types.ZapIndex{}
+	for i := range apps {
+		id := strings.ToLower(apps[i].Name)
+		if apps[i].Id != "" {
+			id = apps[i].Id
+		}
+		if !safePathElement(id) {
+			// ids come from the upstream index, and become directories
+			logger.Warnf("Skipping %q, it is not a valid id", id)
+			continue
+		}
+		fmt.Printf("%s[%s] Replicating\n", tui.Blue("[mirror]"), tui.Yellow(id))
+
+		coreBytes, err := Fetch(config.Mirror, func(mirror string) string {
+			return fmt.Sprintf(mirror, id)
+		})
+		if err != nil {
+			logger.Warnf("Skipping %s, %s", id, err)
+			continue
+		}
+
+		appDir := filepath.Join(dir, id)
+		err = os.MkdirAll(appDir, 0755)
+		if err != nil {
+			return err
+		}
+
+		if options.WithAssets {
+			coreBytes, err = replicateAssets(coreBytes, appDir, id, options, config)
+			if err != nil {
+				return err
+			}
+		}
+
+		err = os.WriteFile(filepath.Join(appDir, "core.json"), coreBytes, 0644)
+		if err != nil {
+			return err
+		}
+		replicated = append(replicated, apps[i])
+	}
+
+	// only list the apps which were replicated, so that search does not
+	// show apps which cannot be installed from this mirror
+	indexBytes, err = json.Marshal(replicated)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(dir, "index.min.json"), indexBytes, 0644)
+}
+
+// safePathElement returns true if name can be used as a single element
+// of a path, without leading outside of the directory it is joined to
+func safePathElement(name string) bool {
+	return name != "" && name != "." && !strings.Contains(name, "..") && !strings.ContainsAny(name, `/\`)
+}
+
+// replicateAssets downloads the assets listed in core.json into appDir,
+// and returns core.json with the download links pointing to the replica.
+// Releases may have assets with the same name, so each asset is stored
+// in a directory named after its sha256, or the tag of its release
+func replicateAssets(coreBytes []byte, appDir string, id string, options ReplicateOptions, config config.Store) ([]byte, error) {
+	core := map[string]interface{}{}
+	err := json.Unmarshal(coreBytes, &core)
+	if err != nil {
+		return nil, err
+	}
+
+	for key, value := range core {
+		release, ok := value.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		assets, ok := release["assets"].(map[string]interface{})
+		if !ok {
+			continue
+		}
+		if options.LatestOnly && key != "0" {
+			// the asset links keep pointing upstream
+			continue
+		}
+		tag, _ := release["tag"].(string)
+
+		for _, assetValue := range assets {
+			asset, ok := assetValue.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			name, _ := asset["name"].(string)
+			download, _ := asset["download"].(string)
+			sum, _ := asset["sha256"].(string)
+			if name == "" || download == "" {
+				continue
+			}
+			name = filepath.Base(name)
+
+			key := tag
+			if sum != "" {
+				key = sum
+			}
+			if !safePathElement(key) || !safePathElement(name) {
+				logger.Warnf("Not replicating %s %s of %s, the link keeps pointing upstream", tag, name, id)
+				continue
+			}
+
+			err = os.MkdirAll(filepath.Join(appDir, key), 0755)
+			if err != nil {
+				return nil, err
+			}
+			target := filepath.Join(appDir, key, name)
+			if _, err := os.Stat(target); os.IsNotExist(err) {
+				err = tui.DownloadFileWithProgressBar(download, target, name, tui.DownloadOptions{
+					Cache:  cache.New(config),
+					Sha256: sum,
+				})
+				if err != nil {
+					_ = os.Remove(target)
+					return nil, err
+				}
+			}
+			asset["download"] = fmt.Sprintf("%s/%s/%s/%s", strings.TrimRight(options.BaseURL, "/"),
+				url.PathEscape(id), url.PathEscape(key), url.PathEscape(name))
+		}
+	}
+	return json.Marshal(core)
+}
@@ -0,0 +1,162 @@
+package index
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/srevinsaju/zap/config"
+	"github.com/srevinsaju/zap/types"
+)
+
+func TestSafePathElement(t *testing.T) {
+	tests := []struct {
+		name string
+		want bool
+	}{
+		{name: "firefox", want: true},
+		{name: "v1.0.2", want: true},
+		{name: "", want: false},
+		{name: ".", want: false},
+		{name: "..", want: false},
+		{name: "../etc", want: false},
+		{name: "a..b", want: false},
+		{name: "release/1.0", want: false},
+		{name: "/etc", want: false},
+		{name: `a\b`, want: false},
+	}
+	for _, tt := range tests {
+		if got := safePathElement(tt.name); got != tt.want {
+			t.Errorf("safePathElement(%q) = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func sha256Hex(s string) string {
+	sum := sha256.Sum256([]byte(s))
+	return hex.EncodeToString(sum[:])
+}
+
+func TestReplicateAssetsWithTheSameName(t *testing.T) {
+	useTempCache(t)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, "AppImage of %s", r.URL.Path)
+	}))
+	defer server.Close()
+
+	v1, v2 := "AppImage of /v1/Foo.AppImage", "AppImage of /v2/Foo.AppImage"
+	core := fmt.Sprintf(`{
+		"owner": "someone",
+		"0": {"tag": "v2", "assets": {"0": {"name": "Foo.AppImage", "download": "%[1]s/v2/Foo.AppImage", "sha256": "%[2]s"}}},
+		"1": {"tag": "v1", "assets": {"0": {"name": "Foo.AppImage", "download": "%[1]s/v1/Foo.AppImage"}}},
+		"2": {"tag": "../v0", "assets": {"0": {"name": "Foo.AppImage", "download": "%[1]s/v0/Foo.AppImage"}}}
+	}`, server.URL, sha256Hex(v2))
+
+	dir := t.TempDir()
+	appDir := filepath.Join(dir, "foo")
+	options := ReplicateOptions{WithAssets: true, BaseURL: "https://mirror.example.com/"}
+	coreBytes, err := replicateAssets([]byte(core), appDir, "foo", options, config.Store{CacheStore: t.TempDir()})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// owner is not a release, so the releases are unmarshalled one by one
+	raw := map[string]json.RawMessage{}
+	if err := json.Unmarshal(coreBytes, &raw); err != nil {
+		t.Fatal(err)
+	}
+	releases := map[string]map[string]interface{}{}
+	for _, key := range []string{"0", "1", "2"} {
+		release := map[string]interface{}{}
+		if err := json.Unmarshal(raw[key], &release); err != nil {
+			t.Fatal(err)
+		}
+		releases[key] = release
+	}
+	download := func(key string) string {
+		asset := releases[key]["assets"].(map[string]interface{})["0"].(map[string]interface{})
+		return asset["download"].(string)
+	}
+
+	tests := []struct {
+		key      string
+		download string
+		file     string
+		content  string
+	}{
+		// keyed on the sha256, which is known
+		{key: "0", download: "https://mirror.example.com/foo/" + sha256Hex(v2) + "/Foo.AppImage",
+			file: filepath.Join(appDir, sha256Hex(v2), "Foo.AppImage"), content: v2},
+		// keyed on the tag
+		{key: "1", download: "https://mirror.example.com/foo/v1/Foo.AppImage",
+			file: filepath.Join(appDir, "v1", "Foo.AppImage"), content: v1},
+		// the tag cannot be a directory, the link keeps pointing upstream
+		{key: "2", download: server.URL + "/v0/Foo.AppImage"},
+	}
+	for _, tt := range tests {
+		if got := download(tt.key); got != tt.download {
+			t.Errorf("download of release %s = %s, want %s", tt.key, got, tt.download)
+		}
+		if tt.file == "" {
+			continue
+		}
+		content, err := os.ReadFile(tt.file)
+		if err != nil {
+			t.Error(err)
+			continue
+		}
+		if string(content) != tt.content {
+			t.Errorf("%s = %q, want %q", tt.file, content, tt.content)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(dir, "v0")); err == nil {
+		t.Error("the asset of ../v0 was written outside of the directory of the app")
+	}
+}
+
+func TestReplicateSkipsInvalidIds(t *testing.T) {
+	useTempCache(t)
+	apps := []types.ZapIndex{{Id: "foo"}, {Id: "../evil"}, {Id: "a/b"}}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/index.min.json":
+			_ = json.NewEncoder(w).Encode(apps)
+		case "/foo/core.json":
+			fmt.Fprint(w, `{"owner": "someone"}`)
+		default:
+			t.Errorf("unexpected request for %s", r.URL.Path)
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	dir := filepath.Join(t.TempDir(), "mirror")
+	err := Replicate(dir, ReplicateOptions{}, config.Store{
+		Mirror:     []string{server.URL + "/%s/core.json"},
+		MirrorRoot: []string{server.URL},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	indexBytes, err := os.ReadFile(filepath.Join(dir, "index.min.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var replicated []types.ZapIndex
+	if err := json.Unmarshal(indexBytes, &replicated); err != nil {
+		t.Fatal(err)
+	}
+	if len(replicated) != 1 || replicated[0].Id != "foo" {
+		t.Errorf("replicated %+v, want only foo", replicated)
+	}
+	if _, err := os.Stat(filepath.Join(filepath.Dir(dir), "evil")); err == nil {
+		t.Error("../evil was replicated outside of the mirror")
+	}
+}
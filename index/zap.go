@@ -3,8 +3,6 @@ package index
 import (
 	"errors"
 	"fmt"
-	"io"
-	"net/http"
 	"runtime"
 	"strconv"
 
@@ -16,24 +14,30 @@ import (
 )
 
 func GetZapReleases(executable string, config config.Store) (*types.ZapReleases, error) {
-	// declare the stuff which we are going to return
-	zapReleases := &types.ZapReleases{}
-
-	// get the target URL based on the Executable name
-	targetUrl := fmt.Sprintf(config.Mirror, executable)
-	logger.Debugf("Fetching %s", targetUrl)
-
-	// create http client and fetch JSON
-	resp, err := http.Get(targetUrl)
+	body, err := FetchZapRecord(executable, config)
 	if err != nil {
 		return nil, err
 	}
-	defer resp.Body.Close()
+	return ParseZapReleases(body)
+}
 
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return nil, err
+// FetchZapRecord fetches the core.json of executable from the first
+// mirror which has it
+func FetchZapRecord(executable string, config config.Store) ([]byte, error) {
+	// the target URL is based on the Executable name
+	body, err := Fetch(config.Mirror, func(mirror string) string {
+		return fmt.Sprintf(mirror, executable)
+	})
+	if err == NotFoundError {
+		return nil, errors.New("this app does not provide any candidate for installation")
 	}
+	return body, err
+}
+
+// ParseZapReleases parses the releases from a core.json
+func ParseZapReleases(body []byte) (*types.ZapReleases, error) {
+	// declare the stuff which we are going to return
+	zapReleases := &types.ZapReleases{}
 
 	// get owner
 	owner, err := jsonparser.GetString(body, "owner")
@@ -109,11 +113,18 @@ func GetZapReleases(executable string, config config.Store) (*types.ZapReleases,
 				return err
 			}
 
+			// sha256 and arch are only provided by indexes generated by
+			// zap index build, so they are optional
+			zapDlAssetSha256, _ := jsonparser.GetString(value_, "sha256")
+			zapDlAssetArch, _ := jsonparser.GetString(value_, "arch")
+
 			logger.Debugf("Creating Asset %s with [%s, %s]", k_, zapDlAssetName, zapDlAssetSize)
 			zapDlAssetsMap[k_] = types.ZapDlAsset{
 				Name:     zapDlAssetName,
 				Download: zapDlAssetDownloadUrl,
 				Size:     zapDlAssetSize,
+				Sha256:   zapDlAssetSha256,
+				Arch:     zapDlAssetArch,
 			}
 			return nil
 		}, "assets")
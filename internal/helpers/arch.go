@@ -1,19 +1,39 @@
 package helpers
 
 import (
+	"debug/elf"
+	"fmt"
 	"runtime"
 	"strings"
 )
 
+// ARCH maps each GOARCH to the names used for it in AppImage file names.
+// Names are matched as substrings, so "arm" cannot be one of them, as it
+// would match the 64-bit ARM AppImages on 32-bit ARM
 var ARCH = map[string][]string{
 	"amd64": {"x86_64", "amd64"},
 	"386":   {"i386", "i686"},
-	"arm":   {"arm"},
-	"arm64": {"armhf", "aarch64"},
+	"arm":   {"armhf", "armv7l"},
+	"arm64": {"aarch64", "arm64"},
+}
+
+// elfMachineArch maps the ELF machine of an AppImage runtime to the
+// architecture names commonly used in AppImage file names
+var elfMachineArch = map[elf.Machine]string{
+	elf.EM_X86_64:  "x86_64",
+	elf.EM_386:     "i686",
+	elf.EM_ARM:     "armhf",
+	elf.EM_AARCH64: "aarch64",
 }
 
 func HasArch(name string) bool {
-	arch := ARCH[runtime.GOARCH]
+	return HasArchFor(name, runtime.GOARCH)
+}
+
+// HasArchFor checks if name contains any of the names of the
+// architecture goarch
+func HasArchFor(name string, goarch string) bool {
+	arch := ARCH[goarch]
 	for i := range arch {
 		if strings.Contains(name, arch[i]) {
 			return true
@@ -21,3 +41,35 @@ func HasArch(name string) bool {
 	}
 	return false
 }
+
+// NormalizeArch converts an architecture name as used in AppImage file
+// names, like x86_64 or aarch64, to its GOARCH
+func NormalizeArch(name string) (string, error) {
+	if _, ok := ARCH[name]; ok {
+		return name, nil
+	}
+	for goarch, names := range ARCH {
+		for i := range names {
+			if names[i] == name {
+				return goarch, nil
+			}
+		}
+	}
+	return "", fmt.Errorf("unknown architecture %s", name)
+}
+
+// ElfArch reads the ELF header of the file at path, and returns the
+// architecture it was built for, as used in AppImage file names
+func ElfArch(path string) (string, error) {
+	elfFile, err := elf.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer elfFile.Close()
+
+	arch, ok := elfMachineArch[elfFile.Machine]
+	if !ok {
+		return "", fmt.Errorf("unsupported architecture %s", elfFile.Machine)
+	}
+	return arch, nil
+}
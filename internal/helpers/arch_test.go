@@ -0,0 +1,59 @@
+package helpers
+
+import "testing"
+
+func TestHasArchFor(t *testing.T) {
+	tests := []struct {
+		name   string
+		goarch string
+		want   bool
+	}{
+		{name: "App-x86_64.AppImage", goarch: "amd64", want: true},
+		{name: "App-amd64.AppImage", goarch: "amd64", want: true},
+		{name: "App-i686.AppImage", goarch: "amd64", want: false},
+		{name: "App-i386.AppImage", goarch: "386", want: true},
+		{name: "App-armhf.AppImage", goarch: "arm", want: true},
+		{name: "App-armv7l.AppImage", goarch: "arm", want: true},
+		// matched "arm" before, a 64-bit AppImage on 32-bit ARM
+		{name: "App-arm64.AppImage", goarch: "arm", want: false},
+		{name: "App-aarch64.AppImage", goarch: "arm", want: false},
+		{name: "App-aarch64.AppImage", goarch: "arm64", want: true},
+		// not matched before
+		{name: "App-arm64.AppImage", goarch: "arm64", want: true},
+		// matched "armhf" before, a 32-bit AppImage on 64-bit ARM
+		{name: "App-armhf.AppImage", goarch: "arm64", want: false},
+		{name: "App.AppImage", goarch: "amd64", want: false},
+	}
+	for _, tt := range tests {
+		if got := HasArchFor(tt.name, tt.goarch); got != tt.want {
+			t.Errorf("HasArchFor(%q, %q) = %v, want %v", tt.name, tt.goarch, got, tt.want)
+		}
+	}
+}
+
+func TestNormalizeArch(t *testing.T) {
+	tests := []struct {
+		name    string
+		want    string
+		wantErr bool
+	}{
+		{name: "x86_64", want: "amd64"},
+		{name: "amd64", want: "amd64"},
+		{name: "i686", want: "386"},
+		{name: "armhf", want: "arm"},
+		{name: "armv7l", want: "arm"},
+		{name: "aarch64", want: "arm64"},
+		{name: "arm64", want: "arm64"},
+		{name: "sparc", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := NormalizeArch(tt.name)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("NormalizeArch(%q) error = %v, wantErr %v", tt.name, err, tt.wantErr)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("NormalizeArch(%q) = %s, want %s", tt.name, got, tt.want)
+		}
+	}
+}
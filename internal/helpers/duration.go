@@ -0,0 +1,27 @@
+package helpers
+
+import (
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ParseDuration parses a duration like time.ParseDuration, and
+// additionally accepts days and weeks, like 90d or 2w
+func ParseDuration(s string) (time.Duration, error) {
+	units := map[string]time.Duration{
+		"d": 24 * time.Hour,
+		"w": 7 * 24 * time.Hour,
+	}
+	for suffix, unit := range units {
+		if !strings.HasSuffix(s, suffix) {
+			continue
+		}
+		n, err := strconv.Atoi(strings.TrimSuffix(s, suffix))
+		if err != nil {
+			break
+		}
+		return time.Duration(n) * unit, nil
+	}
+	return time.ParseDuration(s)
+}
@@ -0,0 +1,37 @@
+package helpers
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseDuration(t *testing.T) {
+	tests := []struct {
+		s       string
+		want    time.Duration
+		wantErr bool
+	}{
+		{s: "90d", want: 90 * 24 * time.Hour},
+		{s: "0d", want: 0},
+		{s: "2w", want: 14 * 24 * time.Hour},
+		{s: "36h", want: 36 * time.Hour},
+		{s: "1h30m", want: 90 * time.Minute},
+		{s: "-1d", want: -24 * time.Hour},
+		{s: "d", wantErr: true},
+		{s: "1.5d", wantErr: true},
+		{s: "1d12h", wantErr: true},
+		{s: "90", wantErr: true},
+		{s: "", wantErr: true},
+		{s: "soon", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := ParseDuration(tt.s)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ParseDuration(%q) error = %v, wantErr %v", tt.s, err, tt.wantErr)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("ParseDuration(%q) = %s, want %s", tt.s, got, tt.want)
+		}
+	}
+}
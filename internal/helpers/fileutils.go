@@ -1,6 +1,8 @@
 package helpers
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
 	"io"
 	"os"
@@ -88,3 +90,19 @@ func CheckIfDirectoryExists(filepath string) bool {
 	}
 	return info.IsDir()
 }
+
+// Sha256File returns the hex encoded sha256 checksum of the file
+// at filepath
+func Sha256File(filepath string) (string, error) {
+	f, err := os.Open(filepath)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
@@ -1,15 +1,242 @@
 package helpers
 
-import "net/http"
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// HTTPOptions configures the HTTP client which is shared by every
+// network call zap makes
+type HTTPOptions struct {
+	// Proxy is the URL of the proxy to use, the proxy is taken from
+	// $HTTPS_PROXY, $HTTP_PROXY and $NO_PROXY if it is empty
+	Proxy string
+
+	// ConnectTimeout limits the time taken to establish a connection,
+	// including the TLS handshake
+	ConnectTimeout time.Duration
+
+	// ReadTimeout limits the time to wait for the next bytes from the
+	// server, so that large downloads are not limited, but stalled
+	// connections are
+	ReadTimeout time.Duration
+
+	// CABundle is a PEM file of certificate authorities which are trusted
+	// in addition to the system ones, for TLS-inspecting proxies
+	CABundle string
+
+	UserAgent string
+
+	// Netrc is the path to a netrc file with credentials per host, which
+	// are sent with basic authentication. Defaults to $NETRC or ~/.netrc
+	Netrc string
+
+	// BearerTokens maps hosts to a token sent as the bearer token
+	BearerTokens map[string]string
+}
+
+var httpClient = http.DefaultClient
+
+// HTTPClient returns the shared HTTP client configured with
+// ConfigureHTTPClient
+func HTTPClient() *http.Client {
+	return httpClient
+}
+
+// ConfigureHTTPClient replaces the shared HTTP client, and the default
+// client and transport of net/http, with ones configured by options
+func ConfigureHTTPClient(options HTTPOptions) error {
+	proxy := http.ProxyFromEnvironment
+	if options.Proxy != "" {
+		proxyUrl, err := url.Parse(options.Proxy)
+		if err != nil {
+			return fmt.Errorf("invalid proxy %s, %s", options.Proxy, err)
+		}
+		proxy = http.ProxyURL(proxyUrl)
+	}
+
+	tlsConfig := &tls.Config{}
+	if options.CABundle != "" {
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			logger.Debugf("Could not load system certificates, %s", err)
+			pool = x509.NewCertPool()
+		}
+		pem, err := os.ReadFile(options.CABundle)
+		if err != nil {
+			return fmt.Errorf("could not read CA bundle, %s", err)
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return fmt.Errorf("no certificates found in CA bundle %s", options.CABundle)
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	dialer := &net.Dialer{
+		Timeout:   options.ConnectTimeout,
+		KeepAlive: 30 * time.Second,
+	}
+
+	netrcPath := options.Netrc
+	if netrcPath == "" {
+		netrcPath = os.Getenv("NETRC")
+	}
+	if netrcPath == "" {
+		home, err := os.UserHomeDir()
+		if err == nil {
+			netrcPath = filepath.Join(home, ".netrc")
+		}
+	}
+	netrc, err := parseNetrc(netrcPath)
+	if err != nil && !os.IsNotExist(err) {
+		logger.Warnf("Could not read %s, %s", netrcPath, err)
+	}
+
+	transport := &authTransport{
+		base: &http.Transport{
+			Proxy: proxy,
+			DialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+				conn, err := dialer.DialContext(ctx, network, addr)
+				if err != nil || options.ReadTimeout == 0 {
+					return conn, err
+				}
+				return &readTimeoutConn{Conn: conn, timeout: options.ReadTimeout}, nil
+			},
+			TLSClientConfig:       tlsConfig,
+			TLSHandshakeTimeout:   options.ConnectTimeout,
+			ResponseHeaderTimeout: options.ReadTimeout,
+			ForceAttemptHTTP2:     true,
+			MaxIdleConns:          10,
+			IdleConnTimeout:       90 * time.Second,
+		},
+		userAgent:    options.UserAgent,
+		bearerTokens: options.BearerTokens,
+		netrc:        netrc,
+	}
+	httpClient = &http.Client{Transport: transport}
+
+	// libraries like appimage-update make their own requests, with
+	// http.Get, or with clients using the default transport
+	http.DefaultTransport = transport
+	http.DefaultClient = httpClient
+	return nil
+}
+
+// readTimeoutConn extends the read deadline of the connection before
+// every read
+type readTimeoutConn struct {
+	net.Conn
+	timeout time.Duration
+}
+
+func (c *readTimeoutConn) Read(b []byte) (int, error) {
+	err := c.Conn.SetReadDeadline(time.Now().Add(c.timeout))
+	if err != nil {
+		return 0, err
+	}
+	return c.Conn.Read(b)
+}
+
+type netrcEntry struct {
+	login    string
+	password string
+}
+
+// authTransport adds the user agent, and the credentials configured for
+// the host of each request. Credentials are matched per request, so that
+// they are not leaked to other hosts on redirects
+type authTransport struct {
+	base         http.RoundTripper
+	userAgent    string
+	bearerTokens map[string]string
+	netrc        map[string]netrcEntry
+}
+
+func (t *authTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	req = req.Clone(req.Context())
+	if t.userAgent != "" && req.Header.Get("User-Agent") == "" {
+		req.Header.Set("User-Agent", t.userAgent)
+	}
+
+	if req.Header.Get("Authorization") == "" {
+		host := req.URL.Hostname()
+		if token, ok := t.bearerTokens[host]; ok {
+			req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", token))
+		} else if entry, ok := t.netrc[host]; ok {
+			req.SetBasicAuth(entry.login, entry.password)
+		} else if entry, ok := t.netrc[""]; ok {
+			req.SetBasicAuth(entry.login, entry.password)
+		}
+	}
+	return t.base.RoundTrip(req)
+}
+
+// parseNetrc reads the machine, login and password tokens from a netrc
+// file. The default entry is stored with an empty host
+func parseNetrc(path string) (map[string]netrcEntry, error) {
+	entries := map[string]netrcEntry{}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return entries, err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	scanner.Split(bufio.ScanWords)
+
+	machine := ""
+	inMachine := false
+	for scanner.Scan() {
+		switch scanner.Text() {
+		case "machine":
+			if !scanner.Scan() {
+				break
+			}
+			machine = scanner.Text()
+			inMachine = true
+		case "default":
+			machine = ""
+			inMachine = true
+		case "login":
+			if scanner.Scan() && inMachine {
+				entry := entries[machine]
+				entry.login = scanner.Text()
+				entries[machine] = entry
+			}
+		case "password":
+			if scanner.Scan() && inMachine {
+				entry := entries[machine]
+				entry.password = scanner.Text()
+				entries[machine] = entry
+			}
+		case "macdef":
+			// macros run until an empty line, which the word scanner
+			// cannot see, so stop parsing here
+			inMachine = false
+		}
+	}
+	return entries, scanner.Err()
+}
 
 func CheckIfOnline() bool {
 	// https://dev.to/obnoxiousnerd/check-if-user-is-connected-to-the-internet-in-go-1hk6
 
 	//Make a request to icanhazip.com
 	//We need the error only, nothing else :)
-	_, err := http.Get("https://icanhazip.com/")
+	resp, err := HTTPClient().Get("https://icanhazip.com/")
 	//err = nil means online
 	if err == nil {
+		resp.Body.Close()
 		return true
 	}
 	//if the "return statement" in the if didn't executed,
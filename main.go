@@ -4,6 +4,8 @@ import (
 	"fmt"
 	"os"
 
+	"github.com/srevinsaju/zap/config"
+	"github.com/srevinsaju/zap/internal/helpers"
 	"github.com/srevinsaju/zap/logging"
 	"github.com/srevinsaju/zap/tui"
 	"github.com/urfave/cli/v2"
@@ -43,6 +45,22 @@ func main() {
 		Copyright: "MIT License 2020-2021",
 	}
 	app.EnableBashCompletion = true
+	app.Before = func(context *cli.Context) error {
+		// every network call goes through the shared HTTP client, so it has
+		// to be configured before any command runs
+		zapConfig, err := config.NewZapConfig(config.GetPath())
+		if err != nil {
+			logger.Debugf("Could not load configuration to configure the HTTP client, %s", err)
+			return nil
+		}
+		err = helpers.ConfigureHTTPClient(zapConfig.HTTPOptions(fmt.Sprintf("zap/%s", BuildVersion)))
+		if err != nil && context.Args().First() == "doctor" {
+			// zap doctor reports the problem with the configuration
+			logger.Debugf("Could not configure the HTTP client, %s", err)
+			return nil
+		}
+		return err
+	}
 	cli.AppHelpTemplate = tui.AppHelpTemplate()
 	app.Commands = []*cli.Command{
 		{
@@ -81,6 +99,14 @@ func main() {
 					Name:  "no-filter",
 					Usage: "Show all appimages regardless of architecture",
 				},
+				&cli.BoolFlag{
+					Name:  "extract",
+					Usage: "Extract the AppImage, and run it without FUSE",
+				},
+				&cli.StringFlag{
+					Name:  "executable-conflict",
+					Usage: "If the executable already exists, or shadows another command: rename, skip, overwrite or fail",
+				},
 			},
 		},
 		{
@@ -139,6 +165,171 @@ func main() {
 			Usage:  "Removes an AppImage",
 			Action: removeAppImageCliContextWrapper,
 		},
+		{
+			Name:      "default",
+			Usage:     "Sets an AppImage as the default application for MIME types or URL schemes",
+			ArgsUsage: "<app> <mimetype|scheme>...",
+			Action:    defaultCliContextWrapper,
+		},
+		{
+			Name:      "adopt",
+			Usage:     "Installs AppImages which are already on disk, or every AppImage in a directory",
+			ArgsUsage: "<path|dir>...",
+			Action:    adoptCliContextWrapper,
+			Flags: []cli.Flag{
+				&cli.StringFlag{
+					Name:  "executable",
+					Usage: "Name of the executable, instead of the one read from the desktop file",
+				},
+				&cli.BoolFlag{
+					Name:  "move",
+					Usage: "Move the AppImages into the local store, instead of installing them where they are",
+				},
+				&cli.StringFlag{
+					Name:  "executable-conflict",
+					Usage: "If the executable already exists, or shadows another command: rename, skip, overwrite or fail",
+				},
+			},
+		},
+		{
+			Name:   "import",
+			Usage:  "Installs the AppImages managed by AppImageLauncher or appimaged",
+			Action: importCliContextWrapper,
+			Flags: []cli.Flag{
+				&cli.StringFlag{
+					Name:  "from",
+					Usage: "Tool to import from, appimagelauncher or appimaged",
+				},
+				&cli.BoolFlag{
+					Name:  "unintegrate",
+					Usage: "Remove the desktop files and icons installed by the tool, so that they are not duplicated",
+				},
+			},
+		},
+		{
+			Name:      "integrate",
+			Usage:     "Integrates an installed AppImage with the desktop",
+			ArgsUsage: "<app>",
+			Action:    integrateCliContextWrapper,
+			Flags: []cli.Flag{
+				&cli.BoolFlag{
+					Name:  "all",
+					Usage: "Integrate every integrated AppImage again, to apply changes to the configuration",
+				},
+			},
+		},
+		{
+			Name:      "unintegrate",
+			Usage:     "Removes the desktop file, icons and shell completions of an installed AppImage",
+			ArgsUsage: "<app>",
+			Action:    unintegrateCliContextWrapper,
+			Flags: []cli.Flag{
+				&cli.BoolFlag{
+					Name:  "all",
+					Usage: "Unintegrate every installed AppImage",
+				},
+			},
+		},
+		{
+			Name:      "verify",
+			Usage:     "Checks that the files of installed AppImages exist, and have not changed",
+			ArgsUsage: "[app...]",
+			Action:    verifyCliContextWrapper,
+		},
+		{
+			Name:      "repair",
+			Usage:     "Recreates the launchers, desktop files and icons of installed AppImages",
+			ArgsUsage: "[app...]",
+			Action:    repairCliContextWrapper,
+		},
+		{
+			Name:  "autostart",
+			Usage: "Manage the AppImages started when you log in",
+			Subcommands: []*cli.Command{
+				{
+					Name:      "enable",
+					Usage:     "Start an AppImage when you log in",
+					ArgsUsage: "<app>",
+					Action:    autostartEnableCliContextWrapper,
+				},
+				{
+					Name:      "disable",
+					Usage:     "Stop starting an AppImage when you log in",
+					ArgsUsage: "<app>",
+					Action:    autostartDisableCliContextWrapper,
+				},
+			},
+		},
+		{
+			Name:  "launch",
+			Usage: "Manage the arguments and environment variables AppImages are launched with",
+			Subcommands: []*cli.Command{
+				{
+					Name:      "set",
+					Usage:     "Replace the launch configuration of an AppImage",
+					ArgsUsage: "<app>",
+					Action:    launchSetCliContextWrapper,
+					Flags: []cli.Flag{
+						repeatedStringFlag("arg", "Argument passed to the AppImage, can be repeated, like --arg=--no-sandbox"),
+						repeatedStringFlag("env", "Environment variable as NAME=value, can be repeated"),
+						&cli.StringFlag{
+							Name:  "working-dir",
+							Usage: "Directory to launch the AppImage in",
+						},
+					},
+				},
+				{
+					Name:      "show",
+					Usage:     "Show the launch configuration of an AppImage",
+					ArgsUsage: "<app>",
+					Action:    launchShowCliContextWrapper,
+				},
+				{
+					Name:      "reset",
+					Usage:     "Launch an AppImage without arguments or environment variables",
+					ArgsUsage: "<app>",
+					Action:    launchResetCliContextWrapper,
+				},
+			},
+		},
+		{
+			Name:  "sandbox",
+			Usage: "Manage the sandboxes AppImages are launched in, with bwrap or firejail",
+			Subcommands: []*cli.Command{
+				{
+					Name:      "set",
+					Usage:     "Set the sandbox profile of an AppImage",
+					ArgsUsage: "<app>",
+					Action:    sandboxSetCliContextWrapper,
+					Flags: []cli.Flag{
+						&cli.StringFlag{
+							Name:  "profile",
+							Usage: "Sandbox profile, one of strict, default or none",
+							Value: "default",
+						},
+					},
+				},
+			},
+		},
+		{
+			Name:  "portable",
+			Usage: "Manage the portable home and config directories of AppImages",
+			Subcommands: []*cli.Command{
+				{
+					Name:      "enable",
+					Usage:     "Keep the data of an AppImage next to it, instead of in your home directory",
+					ArgsUsage: "<app>",
+					Action:    portableEnableCliContextWrapper,
+				},
+			},
+		},
+		{
+			Name:            "run",
+			Usage:           "Runs an installed AppImage, and records when it was used",
+			ArgsUsage:       "<app> [-- args...]",
+			Action:          runCliContextWrapper,
+			SkipFlagParsing: true,
+		},
 		{
 			Name:   "list",
 			Usage:  "List the installed AppImages",
@@ -151,6 +342,10 @@ func main() {
 				&cli.BoolFlag{
 					Name: "index",
 				},
+				&cli.StringFlag{
+					Name:  "unused",
+					Usage: "Only list the AppImages which were not run within a duration, like 90d",
+				},
 			},
 		},
 		{
@@ -158,6 +353,170 @@ func main() {
 			Usage:  "Configure zap interactively",
 			Action: configCliContextWrapper,
 		},
+		{
+			Name:  "index",
+			Usage: "Manage zap compatible indexes",
+			Subcommands: []*cli.Command{
+				{
+					Name:      "build",
+					Usage:     "Generate a zap index from a directory of AppImages, or a YAML description of apps",
+					ArgsUsage: "<directory|apps.yaml>",
+					Action:    indexBuildCliContextWrapper,
+					Flags: []cli.Flag{
+						&cli.StringFlag{
+							Name:    "output",
+							Aliases: []string{"o"},
+							Usage:   "Directory to write the index into",
+							Value:   "zap-index",
+						},
+						&cli.StringFlag{
+							Name:  "base-url",
+							Usage: "URL at which the output directory will be served",
+						},
+						&cli.StringFlag{
+							Name:  "maintainer",
+							Usage: "Maintainer of apps which do not declare one",
+						},
+					},
+				},
+				{
+					Name:      "mirror",
+					Usage:     "Replicate the index from the configured mirrors into a directory",
+					ArgsUsage: "<directory>",
+					Action:    indexMirrorCliContextWrapper,
+					Flags: []cli.Flag{
+						&cli.StringSliceFlag{
+							Name:  "apps",
+							Usage: "Only replicate these apps",
+						},
+						&cli.BoolFlag{
+							Name:  "with-assets",
+							Usage: "Download the AppImages too",
+						},
+						&cli.BoolFlag{
+							Name:  "latest",
+							Usage: "Only download the AppImages of the latest release",
+						},
+						&cli.StringFlag{
+							Name:  "base-url",
+							Usage: "URL at which the directory will be served, required by --with-assets",
+						},
+					},
+				},
+				{
+					Name:      "serve",
+					Usage:     "Serve a directory created by zap index build or zap index mirror over HTTP",
+					ArgsUsage: "<directory>",
+					Action:    indexServeCliContextWrapper,
+					Flags: []cli.Flag{
+						&cli.StringFlag{
+							Name:  "listen",
+							Usage: "Address to listen on",
+							Value: "127.0.0.1:8080",
+						},
+					},
+				},
+			},
+		},
+		{
+			Name:  "bundle",
+			Usage: "Create and install bundles of AppImages for machines without network access",
+			Subcommands: []*cli.Command{
+				{
+					Name:   "create",
+					Usage:  "Pack the latest release of apps from the zap index into a bundle",
+					Action: bundleCreateCliContextWrapper,
+					Flags: []cli.Flag{
+						&cli.StringSliceFlag{
+							Name:     "apps",
+							Usage:    "Apps to pack into the bundle",
+							Required: true,
+						},
+						&cli.StringFlag{
+							Name:    "output",
+							Aliases: []string{"o"},
+							Usage:   "Path to write the bundle to",
+							Value:   "bundle.tar",
+						},
+						&cli.StringFlag{
+							Name:  "arch",
+							Usage: "Architecture of the target machine, for example arm64 or x86_64",
+						},
+					},
+				},
+				{
+					Name:      "install",
+					Usage:     "Install all the apps in a bundle",
+					ArgsUsage: "<bundle.tar>",
+					Action:    bundleInstallCliContextWrapper,
+					Flags: []cli.Flag{
+						&cli.BoolFlag{
+							Name:    "silent",
+							Aliases: []string{"q", "no-interactive"},
+							Usage:   "Do not ask interactive questions, and produce less logging",
+						},
+						&cli.BoolFlag{
+							Name:  "force",
+							Usage: "Install a bundle created for another architecture",
+						},
+					},
+				},
+			},
+		},
+		{
+			Name:  "cache",
+			Usage: "Manage the download cache",
+			Subcommands: []*cli.Command{
+				{
+					Name:   "serve",
+					Usage:  "Serve the cache over HTTP, to be used as CacheProxy by other zap instances",
+					Action: cacheServeCliContextWrapper,
+					Flags: []cli.Flag{
+						&cli.StringFlag{
+							Name:  "listen",
+							Usage: "Address to listen on, use 0.0.0.0:7878 to serve the local network",
+							Value: "127.0.0.1:7878",
+						},
+						&cli.StringSliceFlag{
+							Name:  "allow-host",
+							Usage: "Host to download from for the other zap instances, besides the mirrors and GitHub",
+						},
+					},
+				},
+				{
+					Name:   "size",
+					Usage:  "Show the size of the cache",
+					Action: cacheSizeCliContextWrapper,
+				},
+				{
+					Name:   "clean",
+					Usage:  "Remove all the files from the cache",
+					Action: cacheCleanCliContextWrapper,
+				},
+			},
+		},
+		{
+			Name:   "gc",
+			Usage:  "Remove the files left behind by interrupted updates, and AppImages which are not installed",
+			Action: gcCliContextWrapper,
+			Flags: []cli.Flag{
+				&cli.BoolFlag{
+					Name:  "dry-run",
+					Usage: "Only list what would be removed",
+				},
+			},
+		},
+		{
+			Name:   "doctor",
+			Usage:  "Check the environment and the configuration for common problems",
+			Action: doctorCliContextWrapper,
+			Flags: []cli.Flag{
+				&cli.BoolFlag{
+					Name:  "json",
+					Usage: "Print the results as JSON",
+				},
+			},
+		},
 		{
 			Name:    "daemon",
 			Usage:   "Runs a daemon which periodically checks for updates for installed appimages",
@@ -167,6 +526,7 @@ func main() {
 				&cli.BoolFlag{
 					Name: "install",
 				},
+				repeatedStringFlag("watch", "Install the AppImages which appear in this directory, in addition to WatchDirs, can be repeated"),
 			},
 		},
 	}
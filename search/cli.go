@@ -3,11 +3,10 @@ package search
 import (
 	"encoding/json"
 	"fmt"
-	"io"
-	"net/http"
 	"strings"
 
 	"github.com/ktr0731/go-fuzzyfinder"
+	"github.com/srevinsaju/zap/index"
 	"github.com/srevinsaju/zap/tui"
 	"github.com/srevinsaju/zap/types"
 )
@@ -26,17 +25,10 @@ func splitByWidth(str string, size int) []string {
 	return splitted
 }
 
-func WithCli(mirror string) error {
-	targetUrl := fmt.Sprintf("%s/%s", mirror, "index.min.json")
-	logger.Debugf("Fetching %s", targetUrl)
-
-	resp, err := http.Get(targetUrl)
-	if err != nil {
-		return err
-	}
-	defer resp.Body.Close()
-
-	body, err := io.ReadAll(resp.Body)
+func WithCli(mirrors []string) error {
+	body, err := index.Fetch(mirrors, func(mirror string) string {
+		return fmt.Sprintf("%s/%s", mirror, "index.min.json")
+	})
 	if err != nil {
 		return err
 	}
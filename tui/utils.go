@@ -6,36 +6,107 @@ import (
 	"io"
 	"net/http"
 	"os"
+	"strings"
 
+	"github.com/srevinsaju/zap/cache"
+	"github.com/srevinsaju/zap/internal/helpers"
 	"github.com/srevinsaju/zap/logging"
 )
 
 var logger = logging.GetLogger()
 
+// DownloadOptions configures how DownloadFileWithProgressBar
+// fetches a file
+type DownloadOptions struct {
+	// Cache is consulted before downloading, and the downloaded file is
+	// added to it. Downloads are not cached if Cache is nil
+	Cache *cache.Cache
+
+	// Sha256 is the expected checksum of the file, if known
+	Sha256 string
+}
+
 // DownloadFileWithProgressBar downloads a file from the internet, with the URL url
 // and saves the file in the destination file path 'destination', while showing a
 // progress bar in the command line output. name is used to visually show to a user
 // what kind of file is being downloaded.
-func DownloadFileWithProgressBar(url string, destination string, name string) error {
+func DownloadFileWithProgressBar(url string, destination string, name string, options DownloadOptions) error {
+	if options.Cache != nil {
+		if cached, ok := options.Cache.Lookup(url, options.Sha256); ok {
+			fmt.Printf("Using cached %s\n", name)
+			_, err := helpers.CopyFile(cached, destination)
+			if err == nil {
+				return os.Chmod(destination, 0755)
+			}
+			logger.Warnf("Failed to copy %s from cache, %s", name, err)
+		}
+	}
+
+	// what the proxy serves is only trusted if it can be checked
+	useProxy := options.Cache != nil && options.Cache.Proxy != ""
+	if useProxy && options.Sha256 == "" {
+		logger.Warnf("The checksum of %s is not known, downloading it directly instead of through the cache proxy", name)
+		useProxy = false
+	}
+
+	var err error
+	// the header of the proxy does not tell if the file
+	// has changed on the server, so it is not kept
+	var header http.Header
+	if useProxy {
+		logger.Debugf("Downloading through cache proxy %s", options.Cache.Proxy)
+		_, err = download(options.Cache.ProxyURL(url, options.Sha256), destination, name)
+		if err != nil {
+			logger.Warnf("Cache proxy failed, %s. Downloading directly", err)
+		}
+	}
+	if !useProxy || err != nil {
+		header, err = download(url, destination, name)
+	}
+	if err != nil {
+		return err
+	}
+
+	if options.Sha256 != "" {
+		sum, err := helpers.Sha256File(destination)
+		if err != nil {
+			return err
+		}
+		if !strings.EqualFold(sum, options.Sha256) {
+			return fmt.Errorf("checksum mismatch for %s, expected %s, got %s", name, options.Sha256, sum)
+		}
+	}
+
+	if options.Cache != nil {
+		_, err = options.Cache.Add(url, destination, header)
+		if err != nil {
+			logger.Warnf("Failed to add %s to cache, %s", name, err)
+		}
+	}
+	return nil
+}
+
+// download downloads url to destination, and returns the response header
+func download(url string, destination string, name string) (http.Header, error) {
 	logger.Debug("Attempting to do http request")
 	req, err := http.NewRequest("GET", url, nil)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	resp, err := http.DefaultClient.Do(req)
+	resp, err := helpers.HTTPClient().Do(req)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	defer resp.Body.Close()
 	if resp.StatusCode != http.StatusOK {
-		return errors.New("The file asset cannot be accessed, possibly it was removed.")
+		return nil, errors.New("The file asset cannot be accessed, possibly it was removed.")
 	}
 
-	f, err := os.OpenFile(destination, os.O_CREATE|os.O_WRONLY, 0755)
+	f, err := os.OpenFile(destination, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0755)
 	if err != nil {
-		panic(err)
+		return nil, err
 	}
 
 	fmt.Printf("Downloading %s\n", name)
@@ -47,14 +118,31 @@ func DownloadFileWithProgressBar(url string, destination string, name string) er
 	mw := io.MultiWriter(f, bar)
 	_, err = io.Copy(mw, resp.Body)
 	if err != nil {
-		panic(err)
+		// the caller may retry from another source
+		f.Close()
+		return nil, err
 	}
 
 	err = f.Close()
 	if err != nil {
-		panic(err)
+		return nil, err
 	}
 	// need a newline here
 	fmt.Print("\n")
-	return nil
+	return resp.Header, nil
+}
+
+// HumanizeBytes formats size as a human readable string, like 12.3 MB
+func HumanizeBytes(size int64) string {
+	units := []string{"B", "kB", "MB", "GB", "TB"}
+	value := float64(size)
+	i := 0
+	for value >= 1000 && i < len(units)-1 {
+		value /= 1000
+		i += 1
+	}
+	if i == 0 {
+		return fmt.Sprintf("%d %s", size, units[i])
+	}
+	return fmt.Sprintf("%.1f %s", value, units[i])
 }
@@ -0,0 +1,63 @@
+package tui
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/srevinsaju/zap/cache"
+)
+
+func TestDownloadThroughCacheProxy(t *testing.T) {
+	content := "content of Foo.AppImage"
+	sum := sha256.Sum256([]byte(content))
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, content)
+	}))
+	defer upstream.Close()
+	proxied := 0
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		proxied++
+		fmt.Fprint(w, content)
+	}))
+	defer proxy.Close()
+
+	tests := []struct {
+		name        string
+		sha256      string
+		wantProxied int
+	}{
+		// what the proxy serves could not be checked
+		{name: "without checksum", wantProxied: 0},
+		{name: "with checksum", sha256: hex.EncodeToString(sum[:]), wantProxied: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			proxied = 0
+			destination := filepath.Join(t.TempDir(), "Foo.AppImage")
+			options := DownloadOptions{
+				Cache:  &cache.Cache{Root: t.TempDir(), Proxy: proxy.URL},
+				Sha256: tt.sha256,
+			}
+			err := DownloadFileWithProgressBar(upstream.URL+"/Foo.AppImage", destination, "Foo", options)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if proxied != tt.wantProxied {
+				t.Errorf("the proxy was requested %d times, want %d", proxied, tt.wantProxied)
+			}
+			downloaded, err := os.ReadFile(destination)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(downloaded) != content {
+				t.Errorf("downloaded %q, want %q", downloaded, content)
+			}
+		})
+	}
+}
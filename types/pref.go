@@ -24,10 +24,31 @@ type InstallOptions struct {
 	Silent                 bool
 	UpdateInplace          bool
 	SelectFirst            bool
+
+	// Extract extracts the AppImage at install time, and launches
+	// AppRun, for systems without FUSE
+	Extract bool
+
+	// optional, skips resolving the asset from the zap index
+	Asset *ZapDlAsset
+
+	// optional, the release of the zap index Asset belongs to, and the
+	// source of the app, as recorded in the index
+	Tag    string
+	Source *ZapSource
+
+	// optional, the icon of the app in the zap index, used
+	// if the AppImage does not have one
+	Icon string
+
+	// ExecutableConflict is what to do, if the launcher in ~/.local/bin
+	// conflicts with another file or command, rename, skip, overwrite
+	// or fail. The user is asked, if it is empty
+	ExecutableConflict string
 }
 
 func (options InstallOptions) ToRemoveOptions() RemoveOptions {
-	return RemoveOptions{Executable: options.Executable}
+	return RemoveOptions{Executable: options.Executable, KeepSettings: true}
 }
 
 type RemoveOptions struct {
@@ -36,4 +57,30 @@ type RemoveOptions struct {
 	// optional for inplace updates
 	NewFilepath   string
 	RemoveInPlace bool
+
+	// optional, keeps the settings made for the app, like default
+	// applications, because the app is installed again right after.
+	// RemoveInPlace implies KeepSettings
+	KeepSettings bool
+}
+
+type AdoptOptions struct {
+	// optional, overrides the executable name read
+	// from the desktop file of the AppImage
+	Executable string
+
+	// Move moves the AppImage into the local store, instead
+	// of installing it where it is
+	Move bool
+
+	// Integrate integrates the AppImage with the desktop,
+	// regardless of the configuration
+	Integrate bool
+
+	// Silent does not ask interactive questions
+	Silent bool
+
+	// ExecutableConflict is what to do, if the launcher in ~/.local/bin
+	// conflicts with another file or command, like InstallOptions
+	ExecutableConflict string
 }
@@ -8,7 +8,9 @@ import (
 type ZapDlAsset struct {
 	Name     string `json:"name"`
 	Download string `json:"download"`
-	Size     string `size:"size"`
+	Size     string `json:"size"`
+	Sha256   string `json:"sha256,omitempty"`
+	Arch     string `json:"arch,omitempty"`
 }
 
 func (asset ZapDlAsset) GetBaseName() string {
@@ -37,8 +39,8 @@ type ZapRelease struct {
 }
 
 type ZapSource struct {
-	Type string
-	Url  string
+	Type string `json:"type"`
+	Url  string `json:"url"`
 }
 
 type ZapReleases struct {
@@ -1 +1,43 @@
 package main
+
+import (
+	"strings"
+
+	"github.com/urfave/cli/v2"
+)
+
+// repeatedString is the value of a flag which can be repeated. Unlike
+// cli.StringSliceFlag, the values are not split on commas, which are
+// common in arguments, environment variables and paths
+type repeatedString []string
+
+func (values *repeatedString) Set(value string) error {
+	*values = append(*values, value)
+	return nil
+}
+
+func (values *repeatedString) String() string {
+	if values == nil {
+		return ""
+	}
+	return strings.Join(*values, " ")
+}
+
+// repeatedStringFlag returns a flag, which can be repeated, and whose
+// values are read with repeatedStrings
+func repeatedStringFlag(name string, usage string) *cli.GenericFlag {
+	return &cli.GenericFlag{
+		Name:  name,
+		Usage: usage,
+		Value: &repeatedString{},
+	}
+}
+
+// repeatedStrings returns the values of a flag created with repeatedStringFlag
+func repeatedStrings(context *cli.Context, name string) []string {
+	values, ok := context.Generic(name).(*repeatedString)
+	if !ok || values == nil {
+		return nil
+	}
+	return *values
+}